@@ -1,6 +1,9 @@
 package main
 
 import (
+	"flag"
+	"os"
+
 	"github.com/xbapps/xbvr/pkg/server"
 )
 
@@ -10,5 +13,10 @@ var branch = "master"
 var date = "moment ago"
 
 func main() {
+	// the app flags are parsed when the packages initialise, a command follows them
+	if args := flag.Args(); len(args) > 0 && args[0] == "search" {
+		os.Exit(server.SearchCommand(args[1:]))
+	}
+
 	server.StartServer(version, commit, branch, date)
 }
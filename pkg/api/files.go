@@ -230,14 +230,13 @@ func (i FilesResource) listFiles(req *restful.Request, resp *restful.Response) {
 	for _, file := range files {
 		fws := FileWithSuggestion{File: file}
 		if file.SceneID == 0 && file.Type == "video" {
-			cleanQuery := tasks.CleanFilename(file.Filename)
-			if cleanQuery != "" {
-				fuzzyScenes := tasks.FuzzySearchScenes(cleanQuery)
-				if len(fuzzyScenes) > 0 {
-					fws.SuggestedTitle = fuzzyScenes[0].Title
-					fws.SuggestedScore = fuzzyScenes[0].Score
-					fws.SuggestedID = fuzzyScenes[0].SceneID
-				}
+			fuzzyScenes, err := tasks.MatchFilenameToScenes(file.Filename)
+			if err != nil {
+				log.Error(err)
+			} else if len(fuzzyScenes) > 0 {
+				fws.SuggestedTitle = fuzzyScenes[0].Title
+				fws.SuggestedScore = fuzzyScenes[0].Score
+				fws.SuggestedID = fuzzyScenes[0].SceneID
 			}
 		}
 		result = append(result, fws)
@@ -289,7 +288,7 @@ func (i FilesResource) matchFile(req *restful.Request, resp *restful.Response) {
 	models.AddAction(scene.SceneID, "match", "filenames_arr", scene.FilenamesArr)
 
 	// Finally, update scene available/accessible status
-	scene.UpdateStatus()
+	tasks.RefreshSceneStatus(&scene)
 
 	resp.WriteHeaderAndEntity(http.StatusOK, nil)
 }
@@ -349,7 +348,7 @@ func (i FilesResource) unmatchFile(req *restful.Request, resp *restful.Response)
 		models.AddAction(scene.SceneID, "unmatch", "filenames_arr", scene.FilenamesArr)
 
 		// Finally, update scene available/accessible status
-		scene.UpdateStatus()
+		tasks.RefreshSceneStatus(&scene)
 	}
 
 	resp.WriteHeaderAndEntity(http.StatusOK, scene)
@@ -401,7 +400,7 @@ func removeFileByFileId(fileId uint) models.Scene {
 			db.Delete(&file)
 			if file.SceneID != 0 {
 				scene.GetIfExistByPK(file.SceneID)
-				scene.UpdateStatus()
+				tasks.RefreshSceneStatus(&scene)
 			}
 		}
 	} else {
@@ -434,20 +433,19 @@ func (i FilesResource) autoMatchFiles(req *restful.Request, resp *restful.Respon
 			Matched:  false,
 		}
 
-		cleanQuery := tasks.CleanFilename(file.Filename)
-		if cleanQuery != "" {
-			fuzzyScenes := tasks.FuzzySearchScenes(cleanQuery)
-			if len(fuzzyScenes) > 0 {
-				file.SceneID = fuzzyScenes[0].ID
-				file.Save()
-				fuzzyScenes[0].UpdateStatus()
+		fuzzyScenes, err := tasks.MatchFilenameToScenes(file.Filename)
+		if err != nil {
+			log.Error(err)
+		} else if len(fuzzyScenes) > 0 {
+			file.SceneID = fuzzyScenes[0].ID
+			file.Save()
+			tasks.RefreshSceneStatus(&fuzzyScenes[0])
 
-				result.SceneID = fuzzyScenes[0].SceneID
-				result.Score = fuzzyScenes[0].Score
-				result.Matched = true
+			result.SceneID = fuzzyScenes[0].SceneID
+			result.Score = fuzzyScenes[0].Score
+			result.Matched = true
 
-				log.Infof("Auto-matched file %s to scene %s (Score: %f)", file.Filename, fuzzyScenes[0].SceneID, fuzzyScenes[0].Score)
-			}
+			log.Infof("Auto-matched file %s to scene %s (Score: %f)", file.Filename, fuzzyScenes[0].SceneID, fuzzyScenes[0].Score)
 		}
 
 		results = append(results, result)
@@ -44,41 +44,49 @@ type VersionCheckResponse struct {
 }
 
 type RequestSaveOptionsWeb struct {
-	TagSort              string `json:"tagSort"`
-	SceneHidden          bool   `json:"sceneHidden"`
-	SceneWatchlist       bool   `json:"sceneWatchlist"`
-	SceneFavourite       bool   `json:"sceneFavourite"`
-	SceneWishlist        bool   `json:"sceneWishlist"`
-	SceneWatched         bool   `json:"sceneWatched"`
-	SceneEdit            bool   `json:"sceneEdit"`
-	SceneDuration        bool   `json:"sceneDuration"`
-	SceneCuepoint        bool   `json:"sceneCuepoint"`
-	ShowHspFile          bool   `json:"showHspFile"`
-	ShowSubtitlesFile    bool   `json:"showSubtitlesFile"`
-	SceneTrailerlist     bool   `json:"sceneTrailerlist"`
-	ShowScriptHeatmap    bool   `json:"showScriptHeatmap"`
-	ShowAllHeatmaps      bool   `json:"showAllHeatmaps"`
-	ShowOpenInNewWindow  bool   `json:"showOpenInNewWindow"`
-	UpdateCheck          bool   `json:"updateCheck"`
-	IsAvailOpacity       int    `json:"isAvailOpacity"`
-	SceneCardAspectRatio string `json:"sceneCardAspectRatio"`
-	SceneCardScaleToFit  bool   `json:"sceneCardScaleToFit"`
-	ActorCardAspectRatio string `json:"actorCardAspectRatio"`
-	ActorCardScaleToFit  bool   `json:"actorCardScaleToFit"`
+	TagSort              string   `json:"tagSort"`
+	SceneHidden          bool     `json:"sceneHidden"`
+	SceneWatchlist       bool     `json:"sceneWatchlist"`
+	SceneFavourite       bool     `json:"sceneFavourite"`
+	SceneWishlist        bool     `json:"sceneWishlist"`
+	SceneWatched         bool     `json:"sceneWatched"`
+	SceneEdit            bool     `json:"sceneEdit"`
+	SceneDuration        bool     `json:"sceneDuration"`
+	SceneCuepoint        bool     `json:"sceneCuepoint"`
+	ShowHspFile          bool     `json:"showHspFile"`
+	ShowSubtitlesFile    bool     `json:"showSubtitlesFile"`
+	SceneTrailerlist     bool     `json:"sceneTrailerlist"`
+	ShowScriptHeatmap    bool     `json:"showScriptHeatmap"`
+	ShowAllHeatmaps      bool     `json:"showAllHeatmaps"`
+	ShowOpenInNewWindow  bool     `json:"showOpenInNewWindow"`
+	UpdateCheck          bool     `json:"updateCheck"`
+	IsAvailOpacity       int      `json:"isAvailOpacity"`
+	SceneCardAspectRatio string   `json:"sceneCardAspectRatio"`
+	SceneCardScaleToFit  bool     `json:"sceneCardScaleToFit"`
+	ActorCardAspectRatio string   `json:"actorCardAspectRatio"`
+	ActorCardScaleToFit  bool     `json:"actorCardScaleToFit"`
+	SearchPageSize       int      `json:"searchPageSize"`
+	SearchMatchAnyWord   bool     `json:"searchMatchAnyWord"`
+	SearchExcludeSites   []string `json:"searchExcludeSites"`
 }
 
 type RequestSaveOptionsAdvanced struct {
-	ShowInternalSceneId          bool      `json:"showInternalSceneId"`
-	ShowHSPApiLink               bool      `json:"showHSPApiLink"`
-	ShowSceneSearchField         bool      `json:"showSceneSearchField"`
-	ScraperProxy                 string    `json:"scraperProxy"`
-	StashApiKey                  string    `json:"stashApiKey"`
-	ScrapeActorAfterScene        bool      `json:"scrapeActorAfterScene"`
-	UseImperialEntry             bool      `json:"useImperialEntry"`
-	LinkScenesAfterSceneScraping bool      `json:"linkScenesAfterSceneScraping"`
-	UseAltSrcInFileMatching      bool      `json:"useAltSrcInFileMatching"`
-	UseAltSrcInScriptFilters     bool      `json:"useAltSrcInScriptFilters"`
-	IgnoreReleasedBefore         time.Time `json:"ignoreReleasedBefore"`
+	ShowInternalSceneId          bool                         `json:"showInternalSceneId"`
+	ShowHSPApiLink               bool                         `json:"showHSPApiLink"`
+	ShowSceneSearchField         bool                         `json:"showSceneSearchField"`
+	ScraperProxy                 string                       `json:"scraperProxy"`
+	StashApiKey                  string                       `json:"stashApiKey"`
+	ScrapeActorAfterScene        bool                         `json:"scrapeActorAfterScene"`
+	UseImperialEntry             bool                         `json:"useImperialEntry"`
+	LinkScenesAfterSceneScraping bool                         `json:"linkScenesAfterSceneScraping"`
+	UseAltSrcInFileMatching      bool                         `json:"useAltSrcInFileMatching"`
+	UseAltSrcInScriptFilters     bool                         `json:"useAltSrcInScriptFilters"`
+	IgnoreReleasedBefore         time.Time                    `json:"ignoreReleasedBefore"`
+	FilenameStripWords           []string                     `json:"filenameStripWords"`
+	FilenameCodePatterns         []config.FilenameCodePattern `json:"filenameCodePatterns"`
+	SearchTitleAnalyzer          string                       `json:"searchTitleAnalyzer"`
+	SearchDescriptionAnalyzer    string                       `json:"searchDescriptionAnalyzer"`
+	SearchStemSearchable         bool                         `json:"searchStemSearchable"`
 }
 
 type RequestSaveOptionsFunscripts struct {
@@ -130,8 +138,11 @@ type GetStateResponse struct {
 }
 
 type GetSearchStateResponse struct {
-	DocumentCount uint64 `json:"documentCount"`
-	InProgress    bool   `json:"inProgress"`
+	DocumentCount   uint64 `json:"documentCount"`
+	SceneCount      int    `json:"sceneCount"`
+	IndexExists     bool   `json:"indexExists"`
+	InProgress      bool   `json:"inProgress"`
+	RebuildRequired bool   `json:"rebuildRequired"`
 }
 
 type GetFunscriptCountResponse struct {
@@ -209,10 +220,13 @@ type GetStorageResponse struct {
 	VideoExt          []string        `json:"video_ext"`
 	ForbiddenVideoExt []string        `json:"forbidden_video_ext"`
 	DefaultVideoExt   []string        `json:"default_video_ext"`
+	IndexPath         string          `json:"index_path"`
+	DefaultIndexPath  string          `json:"default_index_path"`
 }
 type RequestSaveOptionsStorage struct {
 	MatchOhash bool     `json:"match_ohash"`
 	VideoExt   []string `json:"video_ext"`
+	IndexPath  string   `json:"index_path"`
 }
 
 type RequestSaveCollectorConfig struct {
@@ -510,6 +524,9 @@ func (i ConfigResource) saveOptionsWeb(req *restful.Request, resp *restful.Respo
 	config.Config.Web.SceneCardScaleToFit = r.SceneCardScaleToFit
 	config.Config.Web.ActorCardAspectRatio = r.ActorCardAspectRatio
 	config.Config.Web.ActorCardScaleToFit = r.ActorCardScaleToFit
+	config.Config.Web.SearchPageSize = r.SearchPageSize
+	config.Config.Web.SearchMatchAnyWord = r.SearchMatchAnyWord
+	config.Config.Web.SearchExcludeSites = r.SearchExcludeSites
 	config.SaveConfig()
 
 	resp.WriteHeaderAndEntity(http.StatusOK, r)
@@ -534,6 +551,23 @@ func (i ConfigResource) saveOptionsAdvanced(req *restful.Request, resp *restful.
 	config.Config.Advanced.UseAltSrcInFileMatching = r.UseAltSrcInFileMatching
 	config.Config.Advanced.UseAltSrcInScriptFilters = r.UseAltSrcInScriptFilters
 	config.Config.Advanced.IgnoreReleasedBefore = r.IgnoreReleasedBefore
+	config.Config.Advanced.FilenameStripWords = r.FilenameStripWords
+	var codePatterns []config.FilenameCodePattern
+	for _, p := range r.FilenameCodePatterns {
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			log.Warnf("Ignoring filename code pattern %v: %v", p.Pattern, err)
+			continue
+		}
+		codePatterns = append(codePatterns, p)
+	}
+	config.Config.Advanced.FilenameCodePatterns = codePatterns
+	if r.SearchTitleAnalyzer != config.Config.Advanced.SearchTitleAnalyzer || r.SearchDescriptionAnalyzer != config.Config.Advanced.SearchDescriptionAnalyzer ||
+		r.SearchStemSearchable != config.Config.Advanced.SearchStemSearchable {
+		log.Warn("Search analyzers changed, rebuild the search index to use the new analyzers")
+	}
+	config.Config.Advanced.SearchTitleAnalyzer = r.SearchTitleAnalyzer
+	config.Config.Advanced.SearchDescriptionAnalyzer = r.SearchDescriptionAnalyzer
+	config.Config.Advanced.SearchStemSearchable = r.SearchStemSearchable
 	config.SaveConfig()
 
 	resp.WriteHeaderAndEntity(http.StatusOK, r)
@@ -611,6 +645,8 @@ func (i ConfigResource) listStorage(req *restful.Request, resp *restful.Response
 	}
 	out.ForbiddenVideoExt = config.ForbiddenVideoExtensions
 	out.DefaultVideoExt = config.DefaultVideoExtensions
+	out.IndexPath = config.Config.Storage.IndexPath
+	out.DefaultIndexPath = common.IndexDirV2
 	resp.WriteHeaderAndEntity(http.StatusOK, out)
 }
 
@@ -778,14 +814,14 @@ func (i ConfigResource) getSearchState(req *restful.Request, resp *restful.Respo
 	var out GetSearchStateResponse
 
 	out.InProgress = models.CheckLock("index")
-	out.DocumentCount = 0
-	if !out.InProgress { // don't open if in progress, bleve open will hang
-		idx, err := tasks.NewIndex("scenes")
-		if err == nil {
-			defer idx.Bleve.Close()
-			out.DocumentCount, _ = idx.Bleve.DocCount()
-		}
+	stats, err := tasks.IndexStats()
+	if err != nil {
+		log.Error(err)
 	}
+	out.DocumentCount = stats.DocumentCount
+	out.SceneCount = stats.SceneCount
+	out.IndexExists = stats.Exists
+	out.RebuildRequired = stats.RebuildRequired
 
 	resp.WriteHeaderAndEntity(http.StatusOK, out)
 }
@@ -800,8 +836,11 @@ func (i ConfigResource) resetCache(req *restful.Request, resp *restful.Response)
 	}
 
 	if cache == "searchIndex" {
-		os.RemoveAll(common.IndexDirV2)
-		os.MkdirAll(common.IndexDirV2, os.ModePerm)
+		if err := tasks.ClearIndex(); err != nil {
+			log.Error(err)
+			APIError(req, resp, http.StatusInternalServerError, err)
+			return
+		}
 		config.State.CacheSize.SearchIndex = 0
 	}
 
@@ -1112,6 +1151,14 @@ func (i ConfigResource) saveOptionsStorage(req *restful.Request, resp *restful.R
 		return
 	}
 
+	if indexPath := strings.TrimSpace(r.IndexPath); indexPath != config.Config.Storage.IndexPath {
+		if err := tasks.MoveSearchIndex(indexPath); err != nil {
+			log.Error(err)
+			APIError(req, resp, http.StatusBadRequest, err)
+			return
+		}
+	}
+
 	config.Config.Storage.MatchOhash = r.MatchOhash
 
 	// Filter, normalize, and deduplicate extensions
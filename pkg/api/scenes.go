@@ -8,7 +8,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/blevesearch/bleve/v2"
 	"github.com/blevesearch/bleve/v2/document"
 	index "github.com/blevesearch/bleve_index_api"
 	restfulspec "github.com/emicklei/go-restful-openapi/v2"
@@ -53,19 +52,20 @@ type RequestDeleteScene struct {
 }
 
 type RequestEditSceneDetails struct {
-	Title        string   `json:"title"`
-	Synopsis     string   `json:"synopsis"`
-	Studio       string   `json:"studio"`
-	Site         string   `json:"site"`
-	SceneURL     string   `json:"scene_url"`
-	ReleaseDate  string   `json:"release_date_text"`
-	Cast         []string `json:"castArray"`
-	Tags         []string `json:"tagsArray"`
-	FilenamesArr string   `json:"filenames_arr"`
-	Images       string   `json:"images"`
-	CoverURL     string   `json:"cover_url"`
-	IsMultipart  bool     `json:"is_multipart"`
-	Duration     string   `json:"duration"`
+	Title         string   `json:"title"`
+	OriginalTitle string   `json:"original_title"`
+	Synopsis      string   `json:"synopsis"`
+	Studio        string   `json:"studio"`
+	Site          string   `json:"site"`
+	SceneURL      string   `json:"scene_url"`
+	ReleaseDate   string   `json:"release_date_text"`
+	Cast          []string `json:"castArray"`
+	Tags          []string `json:"tagsArray"`
+	FilenamesArr  string   `json:"filenames_arr"`
+	Images        string   `json:"images"`
+	CoverURL      string   `json:"cover_url"`
+	IsMultipart   bool     `json:"is_multipart"`
+	Duration      string   `json:"duration"`
 }
 
 type ResponseGetScenes struct {
@@ -73,6 +73,24 @@ type ResponseGetScenes struct {
 	Scenes  []models.Scene `json:"scenes"`
 }
 
+type ResponseSearchScenes struct {
+	Results    int                            `json:"results"`
+	Total      uint64                         `json:"total"`
+	Scenes     []models.Scene                 `json:"scenes"`
+	Facets     map[string][]tasks.SearchFacet `json:"facets,omitempty"`
+	Rebuilding bool                           `json:"rebuilding"` // the search index is being rebuilt, results may be incomplete
+	Truncated  bool                           `json:"truncated"`  // more results were requested than the maximum page size
+	// minutes of every match, only when requested with duration=true
+	TotalDuration int `json:"totalDuration,omitempty"`
+	// corrected queries to offer when nothing matched
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+type ResponseSearchSummaries struct {
+	Results int                  `json:"results"`
+	Scenes  []tasks.SceneSummary `json:"scenes"`
+}
+
 type ResponseGetFilters struct {
 	Cast          []string        `json:"cast"`
 	Tags          []string        `json:"tags"`
@@ -116,8 +134,33 @@ func (i SceneResource) WebService() *restful.WebService {
 		Writes(ResponseGetScenes{}))
 
 	ws.Route(ws.GET("/search").To(i.searchSceneIndex).
+		Param(ws.QueryParameter("q", "Search query").DataType("string")).
+		Param(ws.QueryParameter("offset", "Index of the first result to return").DataType("int")).
+		Param(ws.QueryParameter("size", "Number of results to return, at most 1000").DataType("int")).
+		Param(ws.QueryParameter("mode", "Advanced search: phrase, match or prefix, the default is query string syntax").DataType("string")).
+		Param(ws.QueryParameter("sort", "Sort preset (relevance, newest, longest, rating, largest) or comma separated fields, eg -released,title or -size").DataType("string")).
+		Param(ws.QueryParameter("highlight", "Include the matching title and description fragments").DataType("boolean")).
+		Param(ws.QueryParameter("recency", "Weight given to newer releases, 0 ranks by the text match alone").DataType("number")).
+		Param(ws.QueryParameter("facets", "Include the number of matches per site, tag, cast member and release year").DataType("boolean")).
+		Param(ws.QueryParameter("duration", "Include the total duration in minutes of every match").DataType("boolean")).
+		Param(ws.QueryParameter("matched", "Include the fields each scene matched in, eg cast or title").DataType("boolean")).
+		Param(ws.QueryParameter("recent", "Return the most recently added scenes for an empty query, instead of none").DataType("boolean")).
+		Param(ws.QueryParameter("allSites", "Include the sites excluded from searches in the web settings").DataType("boolean")).
+		Param(ws.QueryParameter("minScore", "Leave out the matches scoring below this").DataType("number")).
+		Param(ws.QueryParameter("favourite", "Only search within the favourite scenes").DataType("boolean")).
+		Param(ws.QueryParameter("wishlist", "Only search within the wishlist scenes").DataType("boolean")).
 		Metadata(restfulspec.KeyOpenAPITags, tags).
-		Writes(ResponseGetScenes{}))
+		Writes(ResponseSearchScenes{}))
+
+	ws.Route(ws.GET("/search/summaries").To(i.searchSceneSummaries).
+		Param(ws.QueryParameter("q", "Search query").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Writes(ResponseSearchSummaries{}))
+
+	ws.Route(ws.GET("/search/cast").To(i.suggestCast).
+		Param(ws.QueryParameter("q", "Start of a cast member's name").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Writes([]string{}))
 
 	ws.Route(ws.GET("/searchfields").To(i.getSearchFields).
 		Metadata(restfulspec.KeyOpenAPITags, tags).
@@ -509,35 +552,47 @@ func (i SceneResource) toggleList(req *restful.Request, resp *restful.Response)
 		return
 	}
 
-	if r.List == "watchlist" {
+	reindex := toggleSceneList(&scene, r.List)
+	scene.Save()
+
+	// indexed flags need to be current for search filters
+	if reindex {
+		tasks.QueueReindex(scene.SceneID)
+	}
+}
+
+// toggleSceneList flips the flag of the scene named by list, it returns true when the flag is one the search index
+// filters on
+func toggleSceneList(scene *models.Scene, list string) bool {
+	if list == "watchlist" {
 		scene.Watchlist = !scene.Watchlist
 	}
 
-	if r.List == "trailerlist" {
+	if list == "trailerlist" {
 		scene.Trailerlist = !scene.Trailerlist
 	}
 
-	if r.List == "favourite" {
+	if list == "favourite" {
 		scene.Favourite = !scene.Favourite
 	}
 
-	if r.List == "needs_update" {
+	if list == "needs_update" {
 		scene.NeedsUpdate = !scene.NeedsUpdate
 	}
 
-	if r.List == "watched" {
+	if list == "watched" {
 		scene.IsWatched = !scene.IsWatched
 	}
 
-	if r.List == "is_hidden" {
+	if list == "is_hidden" {
 		scene.IsHidden = !scene.IsHidden
 	}
 
-	if r.List == "wishlist" && !scene.IsAvailable {
+	if list == "wishlist" && !scene.IsAvailable {
 		scene.Wishlist = !scene.Wishlist
 	}
 
-	scene.Save()
+	return list == "watched" || list == "favourite" || list == "wishlist"
 }
 
 func (i SceneResource) getSearchFields(req *restful.Request, resp *restful.Response) {
@@ -547,19 +602,12 @@ func (i SceneResource) getSearchFields(req *restful.Request, resp *restful.Respo
 	db, _ := models.GetDB()
 	defer db.Close()
 
-	if models.CheckLock("index") {
-		results = append(results, ResponseSceneSearchValue{"Error", "Search indexes locked - reindex in progress"})
-		resp.WriteHeaderAndEntity(http.StatusOK, results)
-		return
-	}
-
-	idx, err := tasks.NewIndex("scenes")
+	idx, err := tasks.GetSceneIndex()
 	if err != nil {
 		results = append(results, ResponseSceneSearchValue{"Error opening indexs", err.Error()})
 		resp.WriteHeaderAndEntity(http.StatusOK, results)
 		return
 	}
-	defer idx.Bleve.Close()
 
 	var scene models.Scene
 	db.Where("id = ?", q).First(&scene)
@@ -627,7 +675,8 @@ func (i SceneResource) searchSceneIndex(req *restful.Request, resp *restful.Resp
 	var fileScenes []models.File
 	if path != "" {
 		db.Where("path like ? and filename like ? and scene_id > 0", "%"+path+"%", "%"+filename+"%").Find(&fileScenes)
-	} else {
+	} else if strings.TrimSpace(filename) != "" {
+		// an empty filename would match every file
 		db.Where("filename like ? and scene_id > 0", "%"+filename+"%").Find(&fileScenes)
 	}
 
@@ -639,12 +688,6 @@ func (i SceneResource) searchSceneIndex(req *restful.Request, resp *restful.Resp
 		}
 	}
 
-	// search bleve search indexes
-	idx, err := tasks.NewIndex("scenes")
-	if err != nil {
-		log.Error(err)
-		return
-	}
 	if strings.HasPrefix(q, "http") {
 		// if searching for a link, see if it is in the external ref table for scene alternate source
 		var extref models.ExternalReference
@@ -667,34 +710,37 @@ func (i SceneResource) searchSceneIndex(req *restful.Request, resp *restful.Resp
 		}
 	}
 
-	defer idx.Bleve.Close()
-	query := bleve.NewQueryStringQuery(q)
-
-	searchRequest := bleve.NewSearchRequest(query)
-	searchRequest.Fields = []string{"Id", "title", "cast", "site", "description"}
-	searchRequest.IncludeLocations = true
-	searchRequest.From = 0
-	searchRequest.Size = 25
-	searchRequest.SortBy([]string{"-_score"})
-
-	searchResults, err := idx.Bleve.Search(searchRequest)
+	// search bleve search indexes
+	var opts tasks.SceneSearchOptions
+	opts.Offset, _ = strconv.Atoi(req.QueryParameter("offset"))
+	opts.Size, _ = strconv.Atoi(req.QueryParameter("size"))
+	opts.Mode = tasks.SearchMode(req.QueryParameter("mode"))
+	if sort := req.QueryParameter("sort"); sort != "" {
+		opts.SortBy = strings.Split(sort, ",")
+	}
+	opts.Highlight, _ = strconv.ParseBool(req.QueryParameter("highlight"))
+	opts.Facets, _ = strconv.ParseBool(req.QueryParameter("facets"))
+	opts.RecencyWeight, _ = strconv.ParseFloat(req.QueryParameter("recency"), 64)
+	opts.TotalDuration, _ = strconv.ParseBool(req.QueryParameter("duration"))
+	opts.MatchedFields, _ = strconv.ParseBool(req.QueryParameter("matched"))
+	opts.RecentWhenEmpty, _ = strconv.ParseBool(req.QueryParameter("recent"))
+	opts.IncludeExcludedSites, _ = strconv.ParseBool(req.QueryParameter("allSites"))
+	opts.MinScore, _ = strconv.ParseFloat(req.QueryParameter("minScore"), 64)
+	opts.FavouriteOnly, _ = strconv.ParseBool(req.QueryParameter("favourite"))
+	opts.WishlistOnly, _ = strconv.ParseBool(req.QueryParameter("wishlist"))
+	result, err := tasks.FuzzySearchScenesWithOptions(q, opts)
 	if err != nil {
 		log.Error(err)
+		APIError(req, resp, http.StatusInternalServerError, err)
 		return
 	}
+	scenes = append(scenes, result.Scenes...)
 
-	for _, v := range searchResults.Hits {
-		var scene models.Scene
-		err := scene.GetIfExist(v.ID)
-		if err != nil {
-			continue
-		}
-
-		scene.Score = v.Score
-		scenes = append(scenes, scene)
+	var suggestions []string
+	if len(scenes) == 0 {
+		suggestions = result.Suggestions
 	}
-
-	resp.WriteHeaderAndEntity(http.StatusOK, ResponseGetScenes{Results: len(scenes), Scenes: scenes})
+	resp.WriteHeaderAndEntity(http.StatusOK, ResponseSearchScenes{Results: len(scenes), Total: result.Total, Scenes: scenes, Facets: result.Facets, Rebuilding: result.Rebuilding, Truncated: result.Truncated, TotalDuration: result.TotalDuration, Suggestions: suggestions})
 }
 
 func (i SceneResource) addSceneCuepoint(req *restful.Request, resp *restful.Response) {
@@ -785,6 +831,8 @@ func (i SceneResource) rateScene(req *restful.Request, resp *restful.Response) {
 	if err == nil {
 		scene.StarRating = r.Rating
 		scene.Save()
+		// the rating is indexed for filtering and sorting
+		tasks.QueueReindex(scene.SceneID)
 	}
 	db.Close()
 
@@ -852,6 +900,10 @@ func (i SceneResource) editScene(req *restful.Request, resp *restful.Response) {
 			scene.Title = r.Title
 			models.AddAction(scene.SceneID, "edit", "title", r.Title)
 		}
+		if scene.OriginalTitle != r.OriginalTitle {
+			scene.OriginalTitle = r.OriginalTitle
+			models.AddAction(scene.SceneID, "edit", "original_title", r.OriginalTitle)
+		}
 		if scene.Synopsis != r.Synopsis {
 			scene.Synopsis = r.Synopsis
 			models.AddAction(scene.SceneID, "edit", "synopsis", r.Synopsis)
@@ -921,8 +973,7 @@ func (i SceneResource) editScene(req *restful.Request, resp *restful.Response) {
 		scene.Save()
 
 		// Update search index with new data
-		scenes := []models.Scene{scene}
-		tasks.IndexScenes(&scenes)
+		tasks.QueueReindex(scene.SceneID)
 
 		resp.WriteHeaderAndEntity(http.StatusOK, scene)
 	}
@@ -1040,3 +1091,28 @@ func (i SceneResource) getSceneAlternateSources(req *restful.Request, resp *rest
 
 	resp.WriteHeaderAndEntity(http.StatusOK, ressults)
 }
+
+func (i SceneResource) searchSceneSummaries(req *restful.Request, resp *restful.Response) {
+	summaries, err := tasks.SearchSceneSummaries(req.QueryParameter("q"))
+	if err != nil {
+		log.Error(err)
+		APIError(req, resp, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp.WriteHeaderAndEntity(http.StatusOK, ResponseSearchSummaries{Results: len(summaries), Scenes: summaries})
+}
+
+func (i SceneResource) suggestCast(req *restful.Request, resp *restful.Response) {
+	names, err := tasks.SuggestCast(req.QueryParameter("q"))
+	if err != nil {
+		log.Error(err)
+		APIError(req, resp, http.StatusInternalServerError, err)
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+
+	resp.WriteHeaderAndEntity(http.StatusOK, names)
+}
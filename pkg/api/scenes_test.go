@@ -0,0 +1,35 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/xbapps/xbvr/pkg/models"
+
+	// before models initialises, see the package
+	_ "github.com/xbapps/xbvr/pkg/internal/testflags"
+)
+
+func TestToggleSceneList(t *testing.T) {
+	scene := models.Scene{IsWatched: true}
+
+	if !toggleSceneList(&scene, "favourite") {
+		t.Error("expected toggling favourite to reindex the scene")
+	}
+	if !scene.Favourite || !scene.IsWatched {
+		t.Errorf("toggling favourite changed watched: favourite %v, watched %v", scene.Favourite, scene.IsWatched)
+	}
+
+	if !toggleSceneList(&scene, "wishlist") {
+		t.Error("expected toggling wishlist to reindex the scene")
+	}
+	if !scene.Wishlist || !scene.IsWatched {
+		t.Errorf("toggling wishlist changed watched: wishlist %v, watched %v", scene.Wishlist, scene.IsWatched)
+	}
+
+	if !toggleSceneList(&scene, "watched") || scene.IsWatched {
+		t.Error("expected toggling watched to flip it and reindex the scene")
+	}
+	if toggleSceneList(&scene, "watchlist") {
+		t.Error("watchlist is not indexed, it should not reindex the scene")
+	}
+}
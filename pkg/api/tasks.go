@@ -22,6 +22,10 @@ type RequestScrapeTPDB struct {
 	SceneUrl string `json:"sceneUrl"`
 }
 
+type RequestIndexScenes struct {
+	SceneIDs []string `json:"sceneIds"`
+}
+
 type RequestSingleScrape struct {
 	Site           string                            `json:"site"`
 	SceneUrl       string                            `json:"sceneurl"`
@@ -76,8 +80,24 @@ func (i TaskResource) WebService() *restful.WebService {
 		Writes(ResponseSceneScrape{}))
 
 	ws.Route(ws.GET("/index").To(i.index).
+		Param(ws.QueryParameter("force", "Index every scene again into a new search index, which replaces the current one once it is built").DataType("boolean")).
+		Param(ws.QueryParameter("dryRun", "Only return how many scenes indexing would add, update and prune").DataType("boolean")).
+		Param(ws.QueryParameter("changed", "Only reindex scenes updated since the last changed run").DataType("boolean")).
 		Metadata(restfulspec.KeyOpenAPITags, tags))
 
+	ws.Route(ws.POST("/index/scenes").To(i.indexScenes).
+		Reads(RequestIndexScenes{}).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Writes(tasks.SceneIndexResult{}))
+
+	ws.Route(ws.GET("/index/verify").To(i.verifyIndex).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Writes(tasks.SearchIndexHealth{}))
+
+	ws.Route(ws.GET("/index/compact").To(i.compactIndex).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Writes(tasks.SearchIndexCompaction{}))
+
 	ws.Route(ws.GET("/preview/generate").To(i.previewGenerate).
 		Metadata(restfulspec.KeyOpenAPITags, tags))
 
@@ -126,9 +146,61 @@ func (i TaskResource) cleanTags(req *restful.Request, resp *restful.Response) {
 }
 
 func (i TaskResource) index(req *restful.Request, resp *restful.Response) {
+	if dryRun, _ := strconv.ParseBool(req.QueryParameter("dryRun")); dryRun {
+		summary, err := tasks.SearchIndexDryRun()
+		if err != nil {
+			log.Error(err)
+			APIError(req, resp, http.StatusInternalServerError, err)
+			return
+		}
+		resp.WriteHeaderAndEntity(http.StatusOK, summary)
+		return
+	}
+	if force, _ := strconv.ParseBool(req.QueryParameter("force")); force {
+		go func() {
+			tasks.RebuildSearchIndex()
+			tasks.CalculateCacheSizes()
+		}()
+		return
+	}
+	if changed, _ := strconv.ParseBool(req.QueryParameter("changed")); changed {
+		go tasks.IndexChanged()
+		return
+	}
 	go tasks.SearchIndex()
 }
 
+func (i TaskResource) indexScenes(req *restful.Request, resp *restful.Response) {
+	var r RequestIndexScenes
+	if err := req.ReadEntity(&r); err != nil {
+		APIError(req, resp, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := tasks.IndexScenesByIDs(r.SceneIDs)
+	if err != nil {
+		log.Error(err)
+		APIError(req, resp, http.StatusInternalServerError, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, result)
+}
+
+func (i TaskResource) verifyIndex(req *restful.Request, resp *restful.Response) {
+	resp.WriteHeaderAndEntity(http.StatusOK, tasks.VerifyIndex())
+}
+
+func (i TaskResource) compactIndex(req *restful.Request, resp *restful.Response) {
+	compaction, err := tasks.CompactIndex()
+	if err != nil {
+		log.Error(err)
+		APIError(req, resp, http.StatusInternalServerError, err)
+		return
+	}
+	tasks.CalculateCacheSizes()
+	resp.WriteHeaderAndEntity(http.StatusOK, compaction)
+}
+
 func (i TaskResource) scrape(req *restful.Request, resp *restful.Response) {
 	qSiteID := req.QueryParameter("site")
 	if qSiteID == "" {
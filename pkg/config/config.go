@@ -20,6 +20,35 @@ type CronSchedule struct {
 	RunAtStartDelay int  `default:"0" json:"runAtStartDelay"`
 }
 
+// FilenameCodePattern is a release code style matched in filenames, each variant is a regexp template such as
+// ${1}-${2} expanded with the groups of the match
+type FilenameCodePattern struct {
+	Pattern  string   `json:"pattern"`
+	Variants []string `json:"variants"`
+}
+
+// SearchFieldBoosts are how much a word of a search matching each field adds to the score of a scene,
+// relative to each other, a boost of 0 stops matches in that field raising the score
+type SearchFieldBoosts struct {
+	Title       float64 `default:"4" json:"title"`
+	Cast        float64 `default:"3" json:"cast"`
+	Tags        float64 `default:"2" json:"tags"`
+	Description float64 `default:"1" json:"description"`
+}
+
+// SearchIndexTuning sets the scorch merge and memory thresholds of the search index, a threshold of 0 keeps the
+// scorch default. LowMemory uses smaller defaults for devices such as a Raspberry Pi, see tasks.lowMemoryTuning,
+// and indexes in batches of at most 100 scenes. Changes apply when the index is next opened.
+type SearchIndexTuning struct {
+	LowMemory                     bool   `default:"false" json:"lowMemory"`
+	MaxSegmentsPerTier            int    `default:"0" json:"maxSegmentsPerTier"`
+	MaxSegmentSize                int64  `default:"0" json:"maxSegmentSize"` // in documents
+	SegmentsPerMergeTask          int    `default:"0" json:"segmentsPerMergeTask"`
+	NumPersisterWorkers           int    `default:"0" json:"numPersisterWorkers"`
+	MaxSizeInMemoryMergePerWorker int    `default:"0" json:"maxSizeInMemoryMergePerWorker"` // in bytes
+	MemoryPressurePauseThreshold  uint64 `default:"0" json:"memoryPressurePauseThreshold"`  // blocked writers before in memory merges stop
+}
+
 type ObjectConfig struct {
 	Server struct {
 		BindAddress string `default:"0.0.0.0" json:"bindAddress"`
@@ -30,41 +59,59 @@ type ObjectConfig struct {
 		Password string `default:"" json:"password"`
 	} `json:"security"`
 	Web struct {
-		TagSort              string `default:"by-tag-count" json:"tagSort"`
-		SceneHidden          bool   `default:"true" json:"sceneHidden"`
-		SceneWatchlist       bool   `default:"true" json:"sceneWatchlist"`
-		SceneFavourite       bool   `default:"true" json:"sceneFavourite"`
-		SceneWishlist        bool   `default:"true" json:"sceneWishlist"`
-		SceneWatched         bool   `default:"false" json:"sceneWatched"`
-		SceneEdit            bool   `default:"false" json:"sceneEdit"`
-		SceneDuration        bool   `default:"false" json:"sceneDuration"`
-		SceneCuepoint        bool   `default:"true" json:"sceneCuepoint"`
-		ShowHspFile          bool   `default:"true" json:"showHspFile"`
-		ShowSubtitlesFile    bool   `default:"true" json:"showSubtitlesFile"`
-		SceneTrailerlist     bool   `default:"true" json:"sceneTrailerlist"`
-		ShowScriptHeatmap    bool   `default:"true" json:"showScriptHeatmap"`
-		ShowAllHeatmaps      bool   `default:"false" json:"showAllHeatmaps"`
-		ShowOpenInNewWindow  bool   `default:"true" json:"showOpenInNewWindow"`
-		UpdateCheck          bool   `default:"true" json:"updateCheck"`
-		IsAvailOpacity       int    `default:"40" json:"isAvailOpacity"`
-		SceneCardAspectRatio string `default:"1:1" json:"sceneCardAspectRatio"`
-		SceneCardScaleToFit  bool   `default:"true" json:"sceneCardScaleToFit"`
-		ActorCardAspectRatio string `default:"1:1" json:"actorCardAspectRatio"`
-		ActorCardScaleToFit  bool   `default:"true" json:"actorCardScaleToFit"`
+		TagSort              string   `default:"by-tag-count" json:"tagSort"`
+		SceneHidden          bool     `default:"true" json:"sceneHidden"`
+		SceneWatchlist       bool     `default:"true" json:"sceneWatchlist"`
+		SceneFavourite       bool     `default:"true" json:"sceneFavourite"`
+		SceneWishlist        bool     `default:"true" json:"sceneWishlist"`
+		SceneWatched         bool     `default:"false" json:"sceneWatched"`
+		SceneEdit            bool     `default:"false" json:"sceneEdit"`
+		SceneDuration        bool     `default:"false" json:"sceneDuration"`
+		SceneCuepoint        bool     `default:"true" json:"sceneCuepoint"`
+		ShowHspFile          bool     `default:"true" json:"showHspFile"`
+		ShowSubtitlesFile    bool     `default:"true" json:"showSubtitlesFile"`
+		SceneTrailerlist     bool     `default:"true" json:"sceneTrailerlist"`
+		ShowScriptHeatmap    bool     `default:"true" json:"showScriptHeatmap"`
+		ShowAllHeatmaps      bool     `default:"false" json:"showAllHeatmaps"`
+		ShowOpenInNewWindow  bool     `default:"true" json:"showOpenInNewWindow"`
+		UpdateCheck          bool     `default:"true" json:"updateCheck"`
+		IsAvailOpacity       int      `default:"40" json:"isAvailOpacity"`
+		SceneCardAspectRatio string   `default:"1:1" json:"sceneCardAspectRatio"`
+		SceneCardScaleToFit  bool     `default:"true" json:"sceneCardScaleToFit"`
+		ActorCardAspectRatio string   `default:"1:1" json:"actorCardAspectRatio"`
+		ActorCardScaleToFit  bool     `default:"true" json:"actorCardScaleToFit"`
+		SearchPageSize       int      `default:"25" json:"searchPageSize"`
+		SearchMatchAnyWord   bool     `default:"false" json:"searchMatchAnyWord"` // a search matches scenes with any of its words rather than all of them
+		SearchExcludeSites   []string `default:"[]" json:"searchExcludeSites"`    // sites whose scenes never appear in search results
 	} `json:"web"`
 	Advanced struct {
-		ShowInternalSceneId          bool      `default:"false" json:"showInternalSceneId"`
-		ShowHSPApiLink               bool      `default:"false" json:"showHSPApiLink"`
-		ShowSceneSearchField         bool      `default:"false" json:"showSceneSearchField"`
-		StashApiKey                  string    `default:"" json:"stashApiKey"`
-		ScraperProxy                 string    `default:"" json:"scraperProxy"`
-		ScrapeActorAfterScene        bool      `default:"true" json:"scrapeActorAfterScene"`
-		UseImperialEntry             bool      `default:"false" json:"useImperialEntry"`
-		ProgressTimeInterval         int       `default:"15" json:"progressTimeInterval"`
-		LinkScenesAfterSceneScraping bool      `default:"true" json:"linkScenesAfterSceneScraping"`
-		UseAltSrcInFileMatching      bool      `default:"true" json:"useAltSrcInFileMatching"`
-		UseAltSrcInScriptFilters     bool      `default:"true" json:"useAltSrcInScriptFilters"`
-		IgnoreReleasedBefore         time.Time `json:"ignoreReleasedBefore"`
+		ShowInternalSceneId          bool                  `default:"false" json:"showInternalSceneId"`
+		ShowHSPApiLink               bool                  `default:"false" json:"showHSPApiLink"`
+		ShowSceneSearchField         bool                  `default:"false" json:"showSceneSearchField"`
+		StashApiKey                  string                `default:"" json:"stashApiKey"`
+		ScraperProxy                 string                `default:"" json:"scraperProxy"`
+		ScrapeActorAfterScene        bool                  `default:"true" json:"scrapeActorAfterScene"`
+		UseImperialEntry             bool                  `default:"false" json:"useImperialEntry"`
+		ProgressTimeInterval         int                   `default:"15" json:"progressTimeInterval"`
+		LinkScenesAfterSceneScraping bool                  `default:"true" json:"linkScenesAfterSceneScraping"`
+		UseAltSrcInFileMatching      bool                  `default:"true" json:"useAltSrcInFileMatching"`
+		UseAltSrcInScriptFilters     bool                  `default:"true" json:"useAltSrcInScriptFilters"`
+		IgnoreReleasedBefore         time.Time             `json:"ignoreReleasedBefore"`
+		FilenameStripWords           []string              `default:"[]" json:"filenameStripWords"`
+		FilenameCodePatterns         []FilenameCodePattern `default:"[]" json:"filenameCodePatterns"`
+		FilenameSiteAliases          map[string]string     `json:"filenameSiteAliases"` // filename words naming a site, eg czechvr, and the site name they stand for
+		SearchDateLocale             string                `json:"searchDateLocale"`    // eg en-GB, how numeric dates like 03/04/2024 are read, empty only accepts 2024-04-03
+		SearchIndexBatchSize         int                   `default:"500" json:"searchIndexBatchSize"`
+		SearchIndexWorkers           int                   `default:"0" json:"searchIndexWorkers"` // 0 uses one per cpu
+		SearchIndexPrune             bool                  `default:"false" json:"searchIndexPrune"`
+		SearchIndexAutoRecover       bool                  `default:"true" json:"searchIndexAutoRecover"` // move an index that cannot be opened aside and rebuild it
+		SearchTitleAnalyzer          string                `default:"simple" json:"searchTitleAnalyzer"`
+		SearchDescriptionAnalyzer    string                `default:"standard" json:"searchDescriptionAnalyzer"`
+		SearchDescriptionMaxLength   int                   `default:"2000" json:"searchDescriptionMaxLength"` // characters of the synopsis indexed, 0 indexes all of it
+		SearchStemSearchable         bool                  `default:"false" json:"searchStemSearchable"`      // stem words that don't name a field, like the en analyzer
+		SearchFieldBoosts            SearchFieldBoosts     `json:"searchFieldBoosts"`
+		SearchIndexTuning            SearchIndexTuning     `json:"searchIndexTuning"`
+		SearchSiteBoosts             map[string]float64    `json:"searchSiteBoosts"` // raise the score of scenes from these sites, sites not listed have a boost of 1
 	} `json:"advanced"`
 	Funscripts struct {
 		ScrapeFunscripts bool `default:"false" json:"scrapeFunscripts"`
@@ -177,6 +224,7 @@ type ObjectConfig struct {
 	Storage struct {
 		MatchOhash bool     `default:"false" json:"match_ohash"`
 		VideoExt   []string `json:"video_ext"`
+		IndexPath  string   `json:"index_path"` // folder for the search index, defaults to the search-v2 folder
 	} `json:"storage"`
 	ScraperSettings struct {
 		TMWVRNet struct {
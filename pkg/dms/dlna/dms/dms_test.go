@@ -5,6 +5,9 @@ import (
 	"net/http"
 	"runtime"
 	"testing"
+
+	// before models initialises, see the package
+	_ "github.com/xbapps/xbvr/pkg/internal/testflags"
 )
 
 type safeFilePathTestCase struct {
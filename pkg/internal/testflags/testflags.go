@@ -0,0 +1,14 @@
+// Package testflags registers the flags of the test binary before package models initialises. Its init parses the
+// command line for the app flags, which fails on the -test.* flags go test passes unless they are already defined.
+// Packages are initialised in import path order once their imports are, so this one runs before models.
+//
+// Import it for its side effect from the tests of any package importing models:
+//
+//	import _ "github.com/xbapps/xbvr/pkg/internal/testflags"
+package testflags
+
+import "testing"
+
+func init() {
+	testing.Init()
+}
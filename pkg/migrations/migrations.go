@@ -851,6 +851,15 @@ func Migrate() {
 				return tx.AutoMigrate(File{}).Error
 			},
 		},
+		{
+			ID: "0084-scene-original-title",
+			Migrate: func(tx *gorm.DB) error {
+				type Scene struct {
+					OriginalTitle string `json:"original_title" sql:"type:varchar(1024);" xbvrbackup:"original_title"`
+				}
+				return tx.AutoMigrate(Scene{}).Error
+			},
+		},
 
 		// ===============================================================================================
 		// Put DB Schema migrations above this line and migrations that rely on the updated schema below
@@ -1214,6 +1223,7 @@ func Migrate() {
 			// rebuild search indexes with new fields
 			ID: "034-rebuild-new-indexes",
 			Migrate: func(d *gorm.DB) error {
+				tasks.CloseSceneIndex()
 				os.RemoveAll(common.IndexDirV2)
 				os.MkdirAll(common.IndexDirV2, os.ModePerm)
 				// rebuild asynchronously, no need to hold up startup, blocking the UI
@@ -1792,6 +1802,7 @@ func Migrate() {
 			// rebuild search indexes with new fields
 			ID: "0060-rebuild-new-indexes",
 			Migrate: func(d *gorm.DB) error {
+				tasks.CloseSceneIndex()
 				os.RemoveAll(common.IndexDirV2)
 				os.MkdirAll(common.IndexDirV2, os.ModePerm)
 				// rebuild asynchronously, no need to hold up startup, blocking the UI
@@ -62,6 +62,7 @@ type Scene struct {
 
 	SceneID         string    `gorm:"index" json:"scene_id" xbvrbackup:"scene_id"`
 	Title           string    `json:"title" sql:"type:varchar(1024);" xbvrbackup:"title"`
+	OriginalTitle   string    `json:"original_title" sql:"type:varchar(1024);" xbvrbackup:"original_title"` // title in the original language when Title is a translation
 	SceneType       string    `json:"scene_type" xbvrbackup:"scene_type"`
 	ScraperId       string    `json:"scraper_id" xbvrbackup:"scraper_id"`
 	Studio          string    `json:"studio" xbvrbackup:"studio"`
@@ -115,6 +116,9 @@ type Scene struct {
 	Description string  `gorm:"-" json:"description" xbvrbackup:"-"`
 	Score       float64 `gorm:"-" json:"_score" xbvrbackup:"-"`
 
+	SearchHighlights map[string][]string `gorm:"-" json:"search_highlights,omitempty" xbvrbackup:"-"`
+	MatchedFields    []string            `gorm:"-" json:"matched_fields,omitempty" xbvrbackup:"-"`
+
 	AlternateSource []ExternalReferenceLink `json:"alternate_source" xbvrbackup:"-"`
 }
 
@@ -385,6 +389,11 @@ func (o *Scene) UpdateStatus() {
 			o.IsScripted = false
 			changed = true
 		}
+
+		if o.TotalFileSize != 0 {
+			o.TotalFileSize = 0
+			changed = true
+		}
 	}
 
 	if o.HasVideoPreview && !o.PreviewExists() {
@@ -533,6 +542,7 @@ func (o *Scene) PopulateSceneFieldsFromExternal(db *gorm.DB, ext ScrapedScene) {
 	o.SceneID = ext.SceneID
 	o.ScraperId = ext.ScraperID
 	o.Title = ext.Title
+	o.OriginalTitle = ext.OriginalTitle
 	o.SceneType = ext.SceneType
 	o.Studio = ext.Studio
 	o.Site = ext.Site
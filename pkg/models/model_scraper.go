@@ -25,6 +25,7 @@ type ScrapedScene struct {
 	SiteID            string   `json:"scene_id"`
 	SceneType         string   `json:"scene_type"`
 	Title             string   `json:"title"`
+	OriginalTitle     string   `json:"original_title"`
 	Studio            string   `json:"studio"`
 	Site              string   `json:"site"`
 	Covers            []string `json:"covers"`
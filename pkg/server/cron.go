@@ -89,6 +89,7 @@ func scrapeCron() {
 func rescanCron() {
 	if !session.HasActiveSession() {
 		tasks.RescanVolumes(-1)
+		tasks.IndexChanged()
 	}
 	log.Println(fmt.Sprintf("Next Rescan Task at %v", cronInstance.Entry(rescanTask).Next))
 }
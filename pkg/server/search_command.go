@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xbapps/xbvr/pkg/config"
+	"github.com/xbapps/xbvr/pkg/tasks"
+)
+
+type searchCommandHit struct {
+	Id    string  `json:"id"`
+	Title string  `json:"title"`
+	Site  string  `json:"site"`
+	Score float64 `json:"score"`
+}
+
+// SearchCommand runs a search of the scene index for xbvr search "<query>" and prints the top hits, it returns the
+// exit code. XBVR must not be running, as the server holds the index open.
+func SearchCommand(args []string) int {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	limit := fs.Int("limit", 20, "Number of hits to print")
+	asJSON := fs.Bool("json", false, "Print the hits as JSON instead of a table")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), `Usage: xbvr search [--limit n] [--json] "<query>"`)
+		fs.PrintDefaults()
+	}
+
+	// flags may come before or after the query
+	var words []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return 2
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		words = append(words, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	q := strings.Join(words, " ")
+	if q == "" {
+		fs.Usage()
+		return 2
+	}
+
+	// log messages would be mixed with the hits on stdout
+	log.Out = os.Stderr
+	log.SetLevel(logrus.WarnLevel)
+
+	config.LoadConfig()
+	if err := tasks.OpenSceneIndexReadOnly(2 * time.Second); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer tasks.CloseSceneIndex()
+
+	scenes, total, err := tasks.FuzzySearchScenesPaged(q, 0, *limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	hits := make([]searchCommandHit, 0, len(scenes))
+	for _, scene := range scenes {
+		hits = append(hits, searchCommandHit{Id: scene.SceneID, Title: scene.Title, Site: scene.Site, Score: scene.Score})
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(hits); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTITLE\tSITE\tSCORE")
+	for _, hit := range hits {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%.3f\n", hit.Id, hit.Title, hit.Site, hit.Score)
+	}
+	w.Flush()
+	fmt.Printf("%v of %v matches\n", len(hits), total)
+	return 0
+}
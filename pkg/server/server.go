@@ -5,8 +5,11 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	auth "github.com/abbot/go-http-auth"
 	restfulspec "github.com/emicklei/go-restful-openapi/v2"
@@ -53,6 +56,11 @@ func StartServer(version, commit, branch, date string) {
 
 	config.LoadConfig()
 
+	if err := tasks.ValidateIndexDir(tasks.IndexDir()); err != nil {
+		log.Errorf("Search index folder %v is not writable, using %v: %v", tasks.IndexDir(), common.IndexDirV2, err)
+		config.Config.Storage.IndexPath = ""
+	}
+
 	// Remove old locks
 	models.RemoveAllLocks()
 
@@ -61,6 +69,8 @@ func StartServer(version, commit, branch, date string) {
 		config.State.Migration.IsRunning = true
 		migrations.Migrate()
 		config.CompleteMigration()
+		// after the migrations, which may remove or rebuild the index
+		tasks.InitSearchIndex()
 	}()
 
 	go tasks.CheckDependencies()
@@ -211,6 +221,9 @@ func StartServer(version, commit, branch, date string) {
 	// Cron
 	SetupCron()
 
+	// Write queued search index edits before exiting
+	go exitOnSignal()
+
 	// List binding addresses
 	addrs, _ := net.InterfaceAddrs()
 	ips := []string{}
@@ -238,6 +251,23 @@ func StartServer(version, commit, branch, date string) {
 	}
 }
 
+func exitOnSignal() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	Shutdown()
+	os.Exit(0)
+}
+
+// Shutdown writes the scene edits still queued for the search index and closes it, call it before exiting
+func Shutdown() {
+	log.Info("Shutting down, writing queued search index changes")
+	tasks.FlushReindexQueue()
+	tasks.FlushIndexQueue()
+	tasks.CloseSceneIndex()
+}
+
 func diskCache(path string) *diskcache.Cache {
 	d := diskv.New(diskv.Options{
 		BasePath:  path,
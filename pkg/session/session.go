@@ -12,6 +12,7 @@ import (
 
 	"github.com/xbapps/xbvr/pkg/common"
 	"github.com/xbapps/xbvr/pkg/models"
+	"github.com/xbapps/xbvr/pkg/tasks"
 )
 
 var (
@@ -154,6 +155,7 @@ func watchSessionFlush() {
 			if !scene.IsWatched {
 				scene.IsWatched = true
 				scene.Save()
+				tasks.QueueReindex(scene.SceneID)
 			}
 		}
 
@@ -258,13 +258,8 @@ func MatchAlternateSources() {
 	tlog.Info("Completed Matching scenes from alternate sources")
 }
 func AltSourceSearch(searchRequest *bleve.SearchRequest) (*bleve.SearchResult, error) {
-	// open and close the search for each search, this stops the search function from locking users out of searching
-	idx, err := NewIndex("scenes")
-	if err != nil {
-		return nil, err
-	}
-	defer idx.Bleve.Close()
-	return idx.Bleve.Search(searchRequest)
+	_, res, err := searchSceneIndex(searchRequest)
+	return res, err
 }
 func UpdateLinks(db *gorm.DB, externalreference_id uint, newLink models.ExternalReferenceLink) {
 	var extref models.ExternalReference
@@ -190,11 +190,14 @@ func sceneDBWriter(wg *sync.WaitGroup, i *uint64, scenes <-chan models.ScrapedSc
 			}
 		}
 		if scene.MasterSiteId == "" {
-			// Add the processed scene to the list to re/index
+			// Add the processed scene to the list to re/index, it is queued now so it can be found while the scrape continues
 			lock.Lock()
 			*processedScenes = append(*processedScenes, scene)
 			lock.Unlock()
 			atomic.AddUint64(i, 1)
+			if !scene.OnlyUpdateScriptData {
+				QueueSceneIndex(scene.SceneID)
+			}
 		}
 		if os.Getenv("DEBUG") != "" {
 			log.Printf("Saved %v", scene.SceneID)
@@ -366,7 +369,9 @@ func Scrape(toScrape string, singleSceneURL string, singeScrapeAdditionalInfo st
 			tlog.Infof("Reapplying edits")
 			ReapplyEdits()
 
+			// reindex again to pick up the reapplied edits and updated cast and tags
 			IndexScrapedScenes(&processedScenes)
+			FlushIndexQueue()
 			if config.Config.Advanced.LinkScenesAfterSceneScraping {
 				MatchAlternateSources()
 			}
@@ -429,6 +434,7 @@ func ScrapeJAVR(queryString string, scraper string) {
 
 				tlog.Infof("Completed JAVR scrape for %d scenes (query: %s)", len(collectedScenes), q)
 				IndexScrapedScenes(&collectedScenes)
+				FlushIndexQueue()
 			} else {
 				tlog.Infof("No new scenes scraped for query: %s", q)
 			}
@@ -1749,7 +1755,7 @@ func UpdateSceneStatus(db *gorm.DB) {
 	db.Model(&models.Scene{}).Find(&scenes)
 
 	for i := range scenes {
-		scenes[i].UpdateStatus()
+		RefreshSceneStatus(&scenes[i])
 		if (i % 70) == 0 {
 			tlog.Infof("Update status of Scenes (%v/%v)", i+1, len(scenes))
 		}
@@ -1,70 +1,537 @@
 package tasks
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
 	"github.com/blevesearch/bleve/v2/analysis/analyzer/simple"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/analysis/char/asciifolding"
+	regexpcharfilter "github.com/blevesearch/bleve/v2/analysis/char/regexp"
+	"github.com/blevesearch/bleve/v2/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/token/porter"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/letter"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/single"
+	unicodetokenizer "github.com/blevesearch/bleve/v2/analysis/tokenizer/unicode"
 	"github.com/blevesearch/bleve/v2/index/scorch"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+	index "github.com/blevesearch/bleve_index_api"
 	"github.com/sirupsen/logrus"
-	"github.com/xbapps/xbvr/pkg/common"
 	"github.com/xbapps/xbvr/pkg/config"
 	"github.com/xbapps/xbvr/pkg/models"
 )
 
+// Index locking:
+//   - searches never lock, bleve serves each search from a snapshot of the index
+//   - writes are serialised by writeMu, which is only held while a single document or batch is written,
+//     so incremental updates such as IndexScenes after a scrape interleave with a running rebuild instead of waiting for it
+//   - a rebuild holds writeMu of the live index while it catches up and swaps the rebuilt index in, the writes waiting
+//     for it are then made to the rebuilt index
+//   - the "index" KV lock is only taken by the full rebuild in SearchIndex, to stop a second rebuild starting
+//     and to show the rebuild in the UI. Nothing else checks it, so callers cannot deadlock against a rebuild.
 type Index struct {
-	Bleve bleve.Index
+	Bleve   bleve.Index
+	writeMu sync.Mutex
+	// the index a rebuild swapped in for this one, writes still made to this handle go to it. Set under writeMu.
+	replacedBy *Index
+
+	mappingVersion int  // version of the mapping the index was built with, see sceneMappingVersion
+	recovered      bool // the index could not be opened and was replaced by an empty one
 }
 
 type SceneIndexed struct {
 	Description string    `json:"description"`
 	Title       string    `json:"title"`
 	Cast        string    `json:"cast"`
+	CastExact   []string  `json:"cast_exact"` // one term per cast member's full name
+	Tags        string    `json:"tags"`
+	TagsExact   []string  `json:"tags_exact"` // one unanalysed term per tag, for the tags facet
 	Site        string    `json:"site"`
+	SiteExact   string    `json:"site_exact"` // unanalysed, for the site facet
+	Studio      string    `json:"studio"`
 	Id          string    `json:"id"`
+	IdExact     string    `json:"id_exact"` // unanalysed, for matching the start of a scene id
+	Path        []string  `json:"path"`     // folders and filename of every file of the scene
 	Released    time.Time `json:"released"`
 	Added       time.Time `json:"added"`
+	AddedAt     int64     `json:"added_at"`   // unix time the scene was added, keeps the order of scenes added on the same day
+	UpdatedAt   int64     `json:"updated_at"` // unix milliseconds the scene was last saved, to find outdated documents
 	Duration    int       `json:"duration"`
+	FileSize    int64     `json:"file_size"` // bytes, summed over every file of the scene
+	Height      *int      `json:"height"`    // tallest video file, not indexed for scenes without one
+	Year        *int      `json:"year"`      // release year, not indexed for scenes without a release date
+	CastCount   int       `json:"cast_count"`
+	Rating      float64   `json:"rating"`      // stars given to the scene, 0 when not rated
+	ImageCount  int       `json:"image_count"` // gallery images scraped for the scene, covers are not counted
+	IsWatched   bool      `json:"watched"`
+	Favourite   bool      `json:"favourite"`
+	Wishlist    bool      `json:"wishlist"`
+	HasCast     bool      `json:"has_cast"`
+	HasTags     bool      `json:"has_tags"`
+	HasScript   bool      `json:"has_script"` // a script file is matched to the scene
+	CoverURL    string    `json:"cover_url"`  // stored only, for showing results without loading the scene
+	// the title in its original language when Title is a translation, often Japanese, CJK text is indexed as bigrams
+	// so words written without spaces match
+	OriginalTitle string `json:"original_title"`
+	// title, original title, cast, tags, site, studio, id and description in one field, searched by words that don't
+	// name a field
+	Searchable string `json:"searchable"`
+}
+
+var (
+	sceneIndex   *Index
+	sceneIndexMu sync.Mutex
+
+	sceneIndexRebuilding atomic.Bool
+)
+
+// ErrSearchIndexUnavailable is returned by searches when the index cannot be opened or searched,
+// as opposed to an empty result when nothing matched
+var ErrSearchIndexUnavailable = errors.New("search index unavailable")
+
+// SceneIndexRebuilding reports whether SearchIndex is running, searches are still served but may be missing
+// scenes until it completes, eg after the index was removed by a migration
+func SceneIndexRebuilding() bool {
+	return sceneIndexRebuilding.Load()
+}
+
+// GetSceneIndex returns the shared scene index, opening it on first use.
+// Searches and index updates all go through this handle, it must not be closed by callers.
+func GetSceneIndex() (*Index, error) {
+	sceneIndexMu.Lock()
+	defer sceneIndexMu.Unlock()
+
+	if sceneIndex == nil {
+		idx, err := newIndexAt(sceneIndexPath())
+		if err != nil {
+			return nil, err
+		}
+		sceneIndex = idx
+		if idx.recovered {
+			go SearchIndex()
+		}
+		if idx.MappingOutdated() {
+			log.Infof("The search index was built with mapping version %v, rebuilding for version %v", idx.mappingVersion, sceneMappingVersion)
+			go RebuildSearchIndex()
+		}
+	}
+	return sceneIndex, nil
+}
+
+// OpenSceneIndexReadOnly opens the shared scene index for searching only, from a process other than the server such
+// as the search command. The server holds the index open, so this fails after timeout while it is running.
+func OpenSceneIndexReadOnly(timeout time.Duration) error {
+	sceneIndexMu.Lock()
+	defer sceneIndexMu.Unlock()
+
+	if sceneIndex != nil {
+		return nil
+	}
+	path := sceneIndexPath()
+	idx, err := bleve.OpenUsing(path, map[string]interface{}{"read_only": true, "bolt_timeout": timeout.String()})
+	if errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+		return fmt.Errorf("search index at %v does not exist, XBVR builds it when it starts", path)
+	}
+	if err != nil {
+		return fmt.Errorf("search index at %v cannot be opened, stop XBVR if it is running: %w", path, err)
+	}
+	sceneIndex = &Index{Bleve: idx, mappingVersion: readMappingVersion(path)}
+	return nil
+}
+
+// InitSearchIndex opens the shared scene index at startup and runs a search to load its segments, so the first
+// search from the UI does not wait for them. An index that does not exist yet is built.
+func InitSearchIndex() {
+	_, statErr := os.Stat(sceneIndexPath())
+
+	t0 := time.Now()
+	idx, err := GetSceneIndex()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if os.IsNotExist(statErr) {
+		log.Infof("No search index found at %v, building it", sceneIndexPath())
+		SearchIndex()
+		return
+	}
+
+	req := bleve.NewSearchRequest(bleve.NewMatchAllQuery())
+	req.Size = 1
+	if _, err := idx.Bleve.Search(req); err != nil {
+		log.Error(err)
+		return
+	}
+	log.Infof("Search index ready in %s", time.Since(t0).Round(time.Millisecond))
+}
+
+// CloseSceneIndex closes the shared scene index so its files can be removed, the next GetSceneIndex call reopens it
+func CloseSceneIndex() {
+	sceneIndexMu.Lock()
+	defer sceneIndexMu.Unlock()
+
+	if sceneIndex != nil {
+		sceneIndex.Bleve.Close()
+		sceneIndex = nil
+	}
+}
+
+func sceneIndexPath() string {
+	return filepath.Join(IndexDir(), "scenes")
 }
 
 func NewIndex(name string) (*Index, error) {
-	i := new(Index)
+	return newIndexAt(filepath.Join(IndexDir(), name))
+}
+
+// castExactAnalyzer keeps a full name as a single lowercase term
+const castExactAnalyzer = "cast_exact"
+
+// pathAnalyzer splits file paths into their folder and filename words
+const (
+	pathAnalyzer   = "path"
+	pathCharFilter = "path_separators"
+)
+
+// the folded analyzers are simple and standard with accents folded to ascii first, so renee finds Renée
+const (
+	simpleFoldedAnalyzer   = "simple_folded"
+	standardFoldedAnalyzer = "standard_folded"
+)
+
+// stemmedFoldedAnalyzer is standard_folded with English words reduced to their stem, so running finds run
+const stemmedFoldedAnalyzer = "standard_folded_stemmed"
+
+// textAnalyzers can be configured for the title and description, cjk splits Chinese, Japanese and Korean text
+// into overlapping pairs of characters so words can be found without spaces between them
+// and en reduces English words to their stem so different forms of a word match
+var textAnalyzers = map[string]bool{simple.Name: true, standard.Name: true, cjk.AnalyzerName: true, en.AnalyzerName: true}
+
+func textAnalyzer(configured string, fallback string) string {
+	if textAnalyzers[configured] {
+		return configured
+	}
+	return fallback
+}
+
+func titleAnalyzer() string {
+	return textAnalyzer(config.Config.Advanced.SearchTitleAnalyzer, simple.Name)
+}
+
+func descriptionAnalyzer() string {
+	return textAnalyzer(config.Config.Advanced.SearchDescriptionAnalyzer, standard.Name)
+}
+
+// titleFieldAnalyzer is the analyzer the title is mapped with, the simple analyzer is folded
+func titleFieldAnalyzer() string {
+	if analyzer := titleAnalyzer(); analyzer != simple.Name {
+		return analyzer
+	}
+	return simpleFoldedAnalyzer
+}
+
+// searchableAnalyzer is the analyzer for words that don't name a field, stemmed when configured
+func searchableAnalyzer() string {
+	if config.Config.Advanced.SearchStemSearchable {
+		return stemmedFoldedAnalyzer
+	}
+	return standardFoldedAnalyzer
+}
+
+// AnalyzersOutdated reports whether the index was built with different title, description or searchable analyzers
+// than are configured, the index has to be rebuilt before a changed analyzer is used
+func (i *Index) AnalyzersOutdated() bool {
+	m := i.Bleve.Mapping()
+	return m.AnalyzerNameForPath("title") != titleFieldAnalyzer() ||
+		m.AnalyzerNameForPath("description") != descriptionAnalyzer() ||
+		m.AnalyzerNameForPath("searchable") != searchableAnalyzer()
+}
+
+// lowMemoryTuning is used for the thresholds left at 0 when SearchIndexTuning.LowMemory is set. Smaller merges of
+// fewer segments, and persisting segments without merging them in memory first when indexing can't keep up, bound
+// the memory merges take on large libraries. Most of the saving of low memory comes from lowMemoryBatchSize though,
+// see BenchmarkIndexMemory for the measurements.
+var lowMemoryTuning = config.SearchIndexTuning{
+	MaxSegmentSize:               20000,
+	SegmentsPerMergeTask:         4,
+	NumPersisterWorkers:          1,
+	MemoryPressurePauseThreshold: 1,
+}
 
-	path := filepath.Join(common.IndexDirV2, name)
+// lowMemoryBatchSize caps the search index batch size when SearchIndexTuning.LowMemory is set
+const lowMemoryBatchSize = 100
 
-	// the simple analyzer is more approriate for the title and cast
-	// note this does not effect search unless the query includes cast: or title:
+// scorchConfig turns the tuning into the scorch config, nil when it keeps every scorch default
+func scorchConfig(t config.SearchIndexTuning) map[string]interface{} {
+	if t.LowMemory {
+		if t.MaxSegmentsPerTier == 0 {
+			t.MaxSegmentsPerTier = lowMemoryTuning.MaxSegmentsPerTier
+		}
+		if t.MaxSegmentSize == 0 {
+			t.MaxSegmentSize = lowMemoryTuning.MaxSegmentSize
+		}
+		if t.SegmentsPerMergeTask == 0 {
+			t.SegmentsPerMergeTask = lowMemoryTuning.SegmentsPerMergeTask
+		}
+		if t.NumPersisterWorkers == 0 {
+			t.NumPersisterWorkers = lowMemoryTuning.NumPersisterWorkers
+		}
+		if t.MaxSizeInMemoryMergePerWorker == 0 {
+			t.MaxSizeInMemoryMergePerWorker = lowMemoryTuning.MaxSizeInMemoryMergePerWorker
+		}
+		if t.MemoryPressurePauseThreshold == 0 {
+			t.MemoryPressurePauseThreshold = lowMemoryTuning.MemoryPressurePauseThreshold
+		}
+	}
+
+	// scorch reads the options over its defaults, so only the thresholds that are set are given
+	merge := map[string]interface{}{}
+	if t.MaxSegmentsPerTier > 0 {
+		merge["MaxSegmentsPerTier"] = t.MaxSegmentsPerTier
+	}
+	if t.MaxSegmentSize > 0 {
+		merge["MaxSegmentSize"] = t.MaxSegmentSize
+	}
+	if t.SegmentsPerMergeTask > 0 {
+		merge["SegmentsPerMergeTask"] = t.SegmentsPerMergeTask
+	}
+	persister := map[string]interface{}{}
+	if t.NumPersisterWorkers > 0 {
+		persister["NumPersisterWorkers"] = t.NumPersisterWorkers
+	}
+	if t.MaxSizeInMemoryMergePerWorker > 0 {
+		persister["MaxSizeInMemoryMergePerWorker"] = t.MaxSizeInMemoryMergePerWorker
+	}
+	if t.MemoryPressurePauseThreshold > 0 {
+		persister["MemoryPressurePauseThreshold"] = t.MemoryPressurePauseThreshold
+	}
+
+	cfg := map[string]interface{}{}
+	if len(merge) > 0 {
+		cfg["scorchMergePlanOptions"] = merge
+	}
+	if len(persister) > 0 {
+		cfg["scorchPersisterOptions"] = persister
+	}
+	if len(cfg) == 0 {
+		return nil
+	}
+	return cfg
+}
+
+func newIndexAt(path string) (*Index, error) {
+	i := new(Index)
+
+	// the simple analyzer is more approriate for the title, cast, tags and studio
+	// note this does not effect search unless the query includes cast:, title:, tags: or studio:
 	titleFieldMapping := bleve.NewTextFieldMapping()
-	titleFieldMapping.Analyzer = simple.Name
+	titleFieldMapping.Analyzer = titleFieldAnalyzer()
+	originalTitleFieldMapping := bleve.NewTextFieldMapping()
+	originalTitleFieldMapping.Analyzer = cjk.AnalyzerName
+	descriptionFieldMapping := bleve.NewTextFieldMapping()
+	descriptionFieldMapping.Analyzer = descriptionAnalyzer()
+	searchableFieldMapping := bleve.NewTextFieldMapping()
+	searchableFieldMapping.Analyzer = searchableAnalyzer()
+	searchableFieldMapping.Store = false
+	searchableFieldMapping.IncludeInAll = false
 	castFieldMapping := bleve.NewTextFieldMapping()
-	castFieldMapping.Analyzer = simple.Name
+	castFieldMapping.Analyzer = simpleFoldedAnalyzer
+	castExactFieldMapping := bleve.NewTextFieldMapping()
+	castExactFieldMapping.Analyzer = castExactAnalyzer
+	tagsFieldMapping := bleve.NewTextFieldMapping()
+	tagsFieldMapping.Analyzer = simple.Name
+	tagsExactFieldMapping := bleve.NewTextFieldMapping()
+	tagsExactFieldMapping.Analyzer = keyword.Name
+	siteExactFieldMapping := bleve.NewTextFieldMapping()
+	siteExactFieldMapping.Analyzer = keyword.Name
+	idExactFieldMapping := bleve.NewTextFieldMapping()
+	idExactFieldMapping.Analyzer = keyword.Name
+	idExactFieldMapping.IncludeInAll = false
+	// paths are only searched with path:, folder names would otherwise match unrelated searches
+	pathFieldMapping := bleve.NewTextFieldMapping()
+	pathFieldMapping.Analyzer = pathAnalyzer
+	pathFieldMapping.IncludeInAll = false
+	studioFieldMapping := bleve.NewTextFieldMapping()
+	studioFieldMapping.Analyzer = simple.Name
+	coverURLFieldMapping := bleve.NewTextFieldMapping()
+	coverURLFieldMapping.Index = false
+	coverURLFieldMapping.IncludeInAll = false
 	releaseFieldMapping := bleve.NewDateTimeFieldMapping()
 	addedFieldMapping := bleve.NewDateTimeFieldMapping()
+	addedAtFieldMapping := bleve.NewNumericFieldMapping()
+	updatedAtFieldMapping := bleve.NewNumericFieldMapping()
 	durationFieldMapping := bleve.NewNumericFieldMapping()
+	fileSizeFieldMapping := bleve.NewNumericFieldMapping()
+	heightFieldMapping := bleve.NewNumericFieldMapping()
+	yearFieldMapping := bleve.NewNumericFieldMapping()
+	castCountFieldMapping := bleve.NewNumericFieldMapping()
+	ratingFieldMapping := bleve.NewNumericFieldMapping()
+	imageCountFieldMapping := bleve.NewNumericFieldMapping()
+	watchedFieldMapping := bleve.NewBooleanFieldMapping()
+	favouriteFieldMapping := bleve.NewBooleanFieldMapping()
+	wishlistFieldMapping := bleve.NewBooleanFieldMapping()
+	hasCastFieldMapping := bleve.NewBooleanFieldMapping()
+	hasTagsFieldMapping := bleve.NewBooleanFieldMapping()
+	hasScriptFieldMapping := bleve.NewBooleanFieldMapping()
 	sceneMapping := bleve.NewDocumentMapping()
 	sceneMapping.AddFieldMappingsAt("title", titleFieldMapping)
+	sceneMapping.AddFieldMappingsAt("original_title", originalTitleFieldMapping)
+	sceneMapping.AddFieldMappingsAt("description", descriptionFieldMapping)
+	sceneMapping.AddFieldMappingsAt("searchable", searchableFieldMapping)
 	sceneMapping.AddFieldMappingsAt("cast", castFieldMapping)
+	sceneMapping.AddFieldMappingsAt("cast_exact", castExactFieldMapping)
+	sceneMapping.AddFieldMappingsAt("tags", tagsFieldMapping)
+	sceneMapping.AddFieldMappingsAt("tags_exact", tagsExactFieldMapping)
+	sceneMapping.AddFieldMappingsAt("site_exact", siteExactFieldMapping)
+	sceneMapping.AddFieldMappingsAt("id_exact", idExactFieldMapping)
+	sceneMapping.AddFieldMappingsAt("path", pathFieldMapping)
+	sceneMapping.AddFieldMappingsAt("studio", studioFieldMapping)
 	sceneMapping.AddFieldMappingsAt("released", releaseFieldMapping)
 	sceneMapping.AddFieldMappingsAt("added", addedFieldMapping)
+	sceneMapping.AddFieldMappingsAt("added_at", addedAtFieldMapping)
+	sceneMapping.AddFieldMappingsAt("updated_at", updatedAtFieldMapping)
 	sceneMapping.AddFieldMappingsAt("duration", durationFieldMapping)
+	sceneMapping.AddFieldMappingsAt("file_size", fileSizeFieldMapping)
+	sceneMapping.AddFieldMappingsAt("height", heightFieldMapping)
+	sceneMapping.AddFieldMappingsAt("year", yearFieldMapping)
+	sceneMapping.AddFieldMappingsAt("cast_count", castCountFieldMapping)
+	sceneMapping.AddFieldMappingsAt("rating", ratingFieldMapping)
+	sceneMapping.AddFieldMappingsAt("image_count", imageCountFieldMapping)
+	sceneMapping.AddFieldMappingsAt("watched", watchedFieldMapping)
+	sceneMapping.AddFieldMappingsAt("favourite", favouriteFieldMapping)
+	sceneMapping.AddFieldMappingsAt("wishlist", wishlistFieldMapping)
+	sceneMapping.AddFieldMappingsAt("has_cast", hasCastFieldMapping)
+	sceneMapping.AddFieldMappingsAt("has_tags", hasTagsFieldMapping)
+	sceneMapping.AddFieldMappingsAt("has_script", hasScriptFieldMapping)
+	sceneMapping.AddFieldMappingsAt("cover_url", coverURLFieldMapping)
 
 	mapping := bleve.NewIndexMapping()
+	err := mapping.AddCustomAnalyzer(castExactAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     single.Name,
+		"token_filters": []string{lowercase.Name},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = mapping.AddCustomCharFilter(pathCharFilter, map[string]interface{}{
+		"type":    regexpcharfilter.Name,
+		"regexp":  `[\\/._\-]`,
+		"replace": " ",
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = mapping.AddCustomAnalyzer(pathAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"char_filters":  []string{pathCharFilter, asciifolding.Name},
+		"tokenizer":     unicodetokenizer.Name,
+		"token_filters": []string{lowercase.Name},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = mapping.AddCustomAnalyzer(simpleFoldedAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"char_filters":  []string{asciifolding.Name},
+		"tokenizer":     letter.Name,
+		"token_filters": []string{lowercase.Name},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = mapping.AddCustomAnalyzer(standardFoldedAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"char_filters":  []string{asciifolding.Name},
+		"tokenizer":     unicodetokenizer.Name,
+		"token_filters": []string{lowercase.Name, en.StopName},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = mapping.AddCustomAnalyzer(stemmedFoldedAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"char_filters":  []string{asciifolding.Name},
+		"tokenizer":     unicodetokenizer.Name,
+		"token_filters": []string{en.PossessiveName, lowercase.Name, en.StopName, porter.Name},
+	})
+	if err != nil {
+		return nil, err
+	}
 	mapping.AddDocumentMapping("_default", sceneMapping)
+	mapping.DefaultField = "searchable"
 
+	// a new index is created unless one already exists at path, any other failure to create it is returned.
+	// The scorch tuning is given each time the index is opened rather than stored in it, so a change to it
+	// applies to an existing index.
+	tuning := scorchConfig(config.Config.Advanced.SearchIndexTuning)
+	created := false
 	idx, err := bleve.NewUsing(path, mapping, scorch.Name, scorch.Name, nil)
-	if err != nil && err == bleve.ErrorIndexPathExists {
-		idx, err = bleve.Open(path)
+	switch {
+	case err == nil:
+		created = true
+	case errors.Is(err, bleve.ErrorIndexPathExists):
+		idx, err = bleve.OpenUsing(path, tuning)
+		if err == nil {
+			break
+		}
+		if !config.Config.Advanced.SearchIndexAutoRecover {
+			return nil, fmt.Errorf("search index at %v cannot be opened: %w", path, err)
+		}
+		// a write cut short, eg by a power loss, can leave an index that cannot be opened. It is moved aside
+		// rather than deleted so it can still be inspected, and replaced by an empty index to be rebuilt.
+		aside := fmt.Sprintf("%v.corrupt-%v", path, time.Now().Format("20060102-150405"))
+		log.Errorf("The search index at %v cannot be opened, moving it to %v and rebuilding it: %v", path, aside, err)
+		if renameErr := os.Rename(path, aside); renameErr != nil {
+			return nil, fmt.Errorf("search index at %v cannot be opened: %v, or moved aside: %v", path, err, renameErr)
+		}
+		idx, err = bleve.NewUsing(path, mapping, scorch.Name, scorch.Name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("search index at %v cannot be recreated: %w", path, err)
+		}
+		created = true
+		i.recovered = true
+	default:
+		return nil, fmt.Errorf("search index at %v cannot be created: %w", path, err)
 	}
-	if err != nil {
-		return nil, err
+	if created {
+		if err := writeMappingVersion(path); err != nil {
+			idx.Close()
+			return nil, err
+		}
+		i.mappingVersion = sceneMappingVersion
+		if tuning != nil {
+			idx.Close()
+			if idx, err = bleve.OpenUsing(path, tuning); err != nil {
+				return nil, fmt.Errorf("search index at %v cannot be opened: %w", path, err)
+			}
+		}
+	} else {
+		i.mappingVersion = readMappingVersion(path)
 	}
 
 	i.Bleve = idx
+	if i.AnalyzersOutdated() {
+		log.Warnf("The search index at %v was built with different title or description analyzers, rebuild the search index to use the configured ones", path)
+	}
 	return i, nil
 }
 
@@ -76,209 +543,632 @@ func (i *Index) Exist(id string) bool {
 	return true
 }
 
-func (i *Index) PutScene(scene models.Scene) error {
-	cast := ""
-	castConcat := ""
-	for _, c := range scene.Cast {
-		cast = cast + " " + c.Name
-		castConcat = castConcat + " " + strings.Replace(c.Name, " ", "", -1)
+// HasFields reports whether the indexed document was stored with all of the named fields,
+// documents indexed before a field was added to SceneIndexed will not have it
+func (i *Index) HasFields(id string, names ...string) bool {
+	d, err := i.Bleve.Document(id)
+	if err != nil || d == nil {
+		return false
 	}
+	found := map[string]bool{}
+	d.VisitFields(func(field index.Field) {
+		found[field.Name()] = true
+	})
+	for _, name := range names {
+		if !found[name] {
+			return false
+		}
+	}
+	return true
+}
 
-	rd := time.Date(scene.ReleaseDate.Year(), scene.ReleaseDate.Month(), scene.ReleaseDate.Day(), 0, 0, 0, 0, &time.Location{})
-	si := SceneIndexed{
-		Title:       fmt.Sprintf("%v", scene.Title),
-		Description: fmt.Sprintf("%v", scene.Synopsis),
-		Cast:        fmt.Sprintf("%v %v", cast, castConcat),
-		Site:        fmt.Sprintf("%v", scene.Site),
-		Id:          fmt.Sprintf("%v", scene.SceneID),
-		Released:    rd,                                       // only index the date, not the time
-		Added:       scene.CreatedAt.Truncate(24 * time.Hour), // only index the date, not the time
-		Duration:    scene.Duration,
+// Current reports whether the indexed document was built from the scene as it is now, by comparing the time the
+// scene was last saved with the one stored in the document. A missing document is not current.
+func (i *Index) Current(scene models.Scene) bool {
+	d, err := i.Bleve.Document(scene.SceneID)
+	if err != nil || d == nil {
+		return false
 	}
+	current := false
+	d.VisitFields(func(field index.Field) {
+		if f, ok := field.(index.NumericField); ok && field.Name() == "updated_at" {
+			if n, err := f.Number(); err == nil {
+				current = int64(n) == scene.UpdatedAt.UnixMilli()
+			}
+		}
+	})
+	return current
+}
 
-	if err := i.Bleve.Index(scene.SceneID, si); err != nil {
-		return err
+// lockWrites takes the write lock of the index, or of the index a rebuild replaced it with, and returns the index
+// that was locked
+func (i *Index) lockWrites() *Index {
+	for {
+		i.writeMu.Lock()
+		next := i.replacedBy
+		if next == nil {
+			return i
+		}
+		i.writeMu.Unlock()
+		i = next
 	}
+}
 
-	return nil
+func (i *Index) PutScene(scene models.Scene) error {
+	w := i.lockWrites()
+	defer w.writeMu.Unlock()
+	return w.Bleve.Index(scene.SceneID, sceneDocument(scene))
 }
 
-func SearchIndex() {
-	if !models.CheckLock("index") {
-		models.CreateLock("index")
-		defer models.RemoveLock("index")
+func (i *Index) DeleteScene(id string) error {
+	w := i.lockWrites()
+	defer w.writeMu.Unlock()
+	return w.Bleve.Delete(id)
+}
 
-		tlog := log.WithFields(logrus.Fields{"task": "scrape"})
+// Batch writes the batch to the index
+func (i *Index) Batch(batch *bleve.Batch) error {
+	w := i.lockWrites()
+	defer w.writeMu.Unlock()
+	return w.Bleve.Batch(batch)
+}
 
-		idx, err := NewIndex("scenes")
-		if err != nil {
-			log.Error(err)
-			models.RemoveLock("index")
-			return
-		}
+// BatchScene adds the scene to the batch, it is written to the index when the batch is executed
+func (i *Index) BatchScene(batch *bleve.Batch, scene models.Scene) error {
+	return batch.Index(scene.SceneID, sceneDocument(scene))
+}
 
-		db, _ := models.GetDB()
-		defer db.Close()
+// searchableText joins the text fields of a scene, so words of a search spread across title, cast and tags
+// are scored together instead of against the best field alone
+func searchableText(si SceneIndexed) string {
+	return strings.Join([]string{si.Title, si.OriginalTitle, si.Cast, si.Tags, si.Site, si.Studio, si.Id, si.Description}, " ")
+}
 
-		total := 0
-		offset := 0
-		current := 0
-		var scenes []models.Scene
-		tx := db.Model(models.Scene{}).Preload("Cast").Preload("Tags")
-		tx.Count(&total)
+// normalizedName compares names ignoring case and spacing
+func normalizedName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
 
-		tlog.Infof("Building search index...")
+// totalFileSize adds up the size of files in bytes
+func totalFileSize(files []models.File) int64 {
+	var size int64
+	for _, f := range files {
+		size += f.Size
+	}
+	return size
+}
 
-		for {
-			tx.Offset(offset).Limit(100).Find(&scenes)
-			if len(scenes) == 0 {
-				break
+// sceneDocument builds the search document stored for a scene
+func sceneDocument(scene models.Scene) SceneIndexed {
+	cast := ""
+	castConcat := ""
+	var castExact []string
+	// merged scrapes can list a cast member twice, each name is indexed once so it doesn't outweigh the other matches
+	seenCast := map[string]bool{}
+	seenNames := map[string]bool{}
+	for _, c := range scene.Cast {
+		if seenCast[normalizedName(c.Name)] {
+			continue
+		}
+		seenCast[normalizedName(c.Name)] = true
+		// aliases are included so the scene is found by any name the cast member is credited under
+		names := []string{c.Name}
+		var aliases []string
+		if c.Aliases != "" {
+			json.Unmarshal([]byte(c.Aliases), &aliases)
+		}
+		names = append(names, aliases...)
+		for _, name := range names {
+			key := normalizedName(name)
+			if key == "" || seenNames[key] {
+				continue
 			}
+			seenNames[key] = true
+			cast = cast + " " + name
+			castConcat = castConcat + " " + strings.Replace(name, " ", "", -1)
+		}
+		castExact = append(castExact, strings.TrimSpace(c.Name))
+	}
+	tags := ""
+	tagsConcat := ""
+	var tagsExact []string
+	for _, t := range scene.Tags {
+		tags = tags + " " + t.Name
+		tagsConcat = tagsConcat + " " + strings.Replace(t.Name, " ", "", -1)
+		tagsExact = append(tagsExact, t.Name)
+	}
 
-			for i := range scenes {
-				if !idx.Exist(scenes[i].SceneID) {
-					err := idx.PutScene(scenes[i])
-					if err != nil {
-						log.Error(err)
-					}
-				}
-				current = current + 1
-			}
-			tlog.Infof("Indexed %v/%v scenes", current, total)
+	studio := strings.TrimSpace(scene.Studio)
+	studioConcat := strings.Replace(studio, " ", "", -1)
 
-			// Update migration status if migration is running
-			if config.State.Migration.IsRunning {
-				msg := fmt.Sprintf("Reindexing scenes: %v/%v", current, total)
-				config.UpdateMigrationStatus(config.State.Migration.Current, current, total, msg)
-			}
+	var paths []string
+	for _, f := range scene.Files {
+		paths = append(paths, f.GetPath())
+	}
 
-			offset = offset + 100
+	var height *int
+	for _, f := range scene.Files {
+		if f.Type == "video" && f.VideoHeight > 0 && (height == nil || f.VideoHeight > *height) {
+			h := f.VideoHeight
+			height = &h
 		}
+	}
 
-		idx.Bleve.Close()
+	var year *int
+	if !scene.ReleaseDate.IsZero() {
+		y := scene.ReleaseDate.Year()
+		year = &y
+	}
 
-		tlog.Infof("Search index built!")
+	imageCount := 0
+	var images []models.Image
+	if err := json.Unmarshal([]byte(scene.Images), &images); err == nil {
+		for _, img := range images {
+			if img.Type == "gallery" && img.URL != "" {
+				imageCount++
+			}
+		}
+	}
+
+	rd := time.Date(scene.ReleaseDate.Year(), scene.ReleaseDate.Month(), scene.ReleaseDate.Day(), 0, 0, 0, 0, time.UTC)
+	si := SceneIndexed{
+		Title:       fmt.Sprintf("%v", scene.Title),
+		Description: truncateOnWord(scene.Synopsis, config.Config.Advanced.SearchDescriptionMaxLength),
+		Cast:        fmt.Sprintf("%v %v", cast, castConcat),
+		CastExact:   castExact,
+		Tags:        fmt.Sprintf("%v %v", tags, tagsConcat),
+		TagsExact:   tagsExact,
+		Site:        fmt.Sprintf("%v", scene.Site),
+		SiteExact:   scene.Site,
+		Studio:      fmt.Sprintf("%v %v", studio, studioConcat),
+		Id:          fmt.Sprintf("%v", scene.SceneID),
+		IdExact:     scene.SceneID,
+		Path:        paths,
+		Released:    rd,                                       // only index the date, not the time
+		Added:       scene.CreatedAt.Truncate(24 * time.Hour), // only index the date, not the time
+		AddedAt:     scene.CreatedAt.Unix(),
+		UpdatedAt:   scene.UpdatedAt.UnixMilli(),
+		Duration:    scene.Duration,
+		FileSize:    totalFileSize(scene.Files),
+		Height:      height,
+		Year:        year,
+		CastCount:   len(castExact),
+		Rating:      scene.StarRating,
+		ImageCount:  imageCount,
+		IsWatched:   scene.IsWatched,
+		Favourite:   scene.Favourite,
+		Wishlist:    scene.Wishlist,
+		HasCast:     len(scene.Cast) > 0,
+		HasTags:     len(scene.Tags) > 0,
+		HasScript:   scene.IsScripted,
+		CoverURL:    scene.CoverURL,
 	}
+	si.OriginalTitle = scene.OriginalTitle
+	si.Searchable = searchableText(si)
+
+	return si
 }
 
-/**
- * Update search index for all of the specified scenes.
- */
-func IndexScenes(scenes *[]models.Scene) {
+const defaultIndexBatchSize = 500
+
+func indexBatchSize() int {
+	size := defaultIndexBatchSize
+	if config.Config.Advanced.SearchIndexBatchSize > 0 {
+		size = config.Config.Advanced.SearchIndexBatchSize
+	}
+	// every document of a batch is held in memory until the batch is written
+	if config.Config.Advanced.SearchIndexTuning.LowMemory && size > lowMemoryBatchSize {
+		size = lowMemoryBatchSize
+	}
+	return size
+}
+
+// SearchIndex adds scenes missing from the search index and reindexes scenes saved since they were indexed,
+// documents of unchanged scenes are kept as they are
+func SearchIndex() {
+	searchIndex(false)
+}
+
+// RebuildSearchIndex indexes every scene again into a new search index, so all documents use the current mapping.
+// Searches use the existing index until the new one replaces it.
+func RebuildSearchIndex() {
+	searchIndex(true)
+}
+
+// backfillFields were added to documents after the first index versions, documents without them are reindexed
+var backfillFields = []string{"tags", "studio", "added_at"}
+
+func searchIndex(forceRebuild bool) {
 	if !models.CheckLock("index") {
 		models.CreateLock("index")
 		defer models.RemoveLock("index")
+		sceneIndexRebuilding.Store(true)
+		defer sceneIndexRebuilding.Store(false)
 
 		tlog := log.WithFields(logrus.Fields{"task": "scrape"})
 
-		idx, err := NewIndex("scenes")
-		if err != nil {
-			log.Error(err)
-			models.RemoveLock("index")
-			return
+		// an index built with an older mapping is rebuilt rather than backfilled, the rebuild started when it was
+		// opened is skipped while this one holds the lock
+		if !forceRebuild {
+			if idx, err := GetSceneIndex(); err == nil && idx.MappingOutdated() {
+				forceRebuild = true
+			}
 		}
 
-		tlog.Infof("Adding scraped scenes to search index...")
-
-		total := 0
-		lastMessage := time.Now()
-		for i := range *scenes {
-			if time.Since(lastMessage) > time.Duration(config.Config.Advanced.ProgressTimeInterval)*time.Second {
-				tlog.Infof("Indexed %v of %v scenes", total, len(*scenes))
-				lastMessage = time.Now()
-			}
-			scene := (*scenes)[i]
-			if idx.Exist(scene.SceneID) {
-				// Remove old index, as data may have been updated
-				idx.Bleve.Delete(scene.SceneID)
+		progress := newIndexProgress("update")
+		if forceRebuild {
+			progress = newIndexProgress("rebuild")
+		}
+		current := 0
+		if forceRebuild {
+			// searches are served by the live index until the rebuilt one replaces it
+			started := time.Now()
+			var caughtUp time.Time
+			err := rebuildSceneIndex(func(idx *Index) error {
+				current = indexAllScenes(idx, progress)
+				// scenes saved while the rebuild was running went to the live index
+				caughtUp = time.Now()
+				return indexScenesUpdatedSince(idx, started)
+			}, func(idx *Index) error {
+				// with writes to the live index held, the scenes saved during the catch up are indexed again and
+				// the scenes deleted during the rebuild are removed
+				if err := indexScenesUpdatedSince(idx, caughtUp); err != nil {
+					return err
+				}
+				_, err := idx.pruneDeletedScenes(false, existingSceneIDs)
+				return err
+			})
+			if err != nil {
+				log.Error(err)
+				return
 			}
-
-			err := idx.PutScene(scene)
+			tlog.Infof("Replaced the search index with the rebuilt one")
+		} else {
+			idx, err := GetSceneIndex()
 			if err != nil {
 				log.Error(err)
-			} else {
-				// log.Debugln("Indexed " + scene.SceneID)
-				total += 1
+				models.RemoveLock("index")
+				return
 			}
+			current = indexAllScenes(idx, progress)
 		}
 
-		idx.Bleve.Close()
+		if config.Config.Advanced.SearchIndexPrune {
+			if _, err := PruneDeletedScenes(false); err != nil {
+				log.Error(err)
+			}
+		}
 
-		tlog.Infof("Indexed %v scenes", total)
+		tlog.Infof("Search index built!")
+		progress.done(current, "Search index built")
 	}
 }
 
-func DeleteIndexScenes(scenes *[]models.Scene) {
-	if !models.CheckLock("index") {
-		models.CreateLock("index")
-		defer models.RemoveLock("index")
+// indexAllScenes writes every scene in the db that is not current in idx and returns how many scenes were read
+func indexAllScenes(idx *Index, progress *indexProgress) int {
+	tlog := log.WithFields(logrus.Fields{"task": "scrape"})
 
-		tlog := log.WithFields(logrus.Fields{"task": "scrape"})
+	db, _ := models.GetDB()
+	defer db.Close()
 
-		idx, err := NewIndex("scenes")
-		if err != nil {
-			log.Error(err)
-			models.RemoveLock("index")
-			return
-		}
+	total := 0
+	offset := 0
+	current := 0
+	// preloading the cast loads the whole actor, including the aliases that are indexed with the cast
+	tx := db.Model(models.Scene{}).Preload("Cast").Preload("Tags").Preload("Files")
+	tx.Count(&total)
 
-		tlog.Infof("Deleting scenes from search index...")
+	workers := indexWorkers()
+	tlog.Infof("Building search index with %v workers...", workers)
+	progress.update(0, total, "Building search index")
 
-		total := 0
-		lastMessage := time.Now()
-		for i := range *scenes {
-			if time.Since(lastMessage) > time.Duration(config.Config.Advanced.ProgressTimeInterval)*time.Second {
-				tlog.Infof("Deleting scene index %v of %v scenes", total, len(*scenes))
-				lastMessage = time.Now()
-			}
-			scene := (*scenes)[i]
-			if idx.Exist(scene.SceneID) {
-				// Remove old index, as data may have been updated
-				idx.Bleve.Delete(scene.SceneID)
-			}
+	// pages are read from the db here while the workers build and batch the documents
+	queue := make(chan models.Scene, 100)
+	batcher := newSceneBatcher(idx, indexBatchSize())
+	wg := indexSceneWorkers(batcher, workers, queue, func(scene models.Scene) bool {
+		return idx.Current(scene) && idx.HasFields(scene.SceneID, backfillFields...)
+	})
+	for {
+		var scenes []models.Scene
+		tx.Offset(offset).Limit(100).Find(&scenes)
+		if len(scenes) == 0 {
+			break
+		}
+
+		for i := range scenes {
+			queue <- scenes[i]
+			current = current + 1
 		}
+		tlog.Infof("Indexed %v/%v scenes", current, total)
+		progress.update(current, total, fmt.Sprintf("Indexed %v/%v scenes", current, total))
 
-		idx.Bleve.Close()
+		// Update migration status if migration is running
+		if config.State.Migration.IsRunning {
+			msg := fmt.Sprintf("Reindexing scenes: %v/%v", current, total)
+			config.UpdateMigrationStatus(config.State.Migration.Current, current, total, msg)
+		}
 
-		tlog.Infof("Indexed %v scenes", total)
+		offset = offset + 100
 	}
+	close(queue)
+	wg.Wait()
+	if err := batcher.flush(); err != nil {
+		log.Error(err)
+	}
+	return current
 }
 
 /**
- * Update search index for all of the specified scrapedScenes.
- * This method will first read the scraped scenes from the DB, after
- * which it calls IndexScenes.
+ * Update search index for all of the specified scenes.
+ * The ids of the scenes that could not be indexed, even when retried, are returned and saved for
+ * RetryFailedIndexScenes.
  */
-func IndexScrapedScenes(scrapedScenes *[]models.ScrapedScene) {
-	// Map scrapedScenes to Scenes
-	var scenes []models.Scene
-	for i := range *scrapedScenes {
-		var scene models.Scene
-		scrapedScene := (*scrapedScenes)[i]
-		// Read scraped scene from db, as we don't want to index it
-		// if it doesn't exist in there
-		err := scene.GetIfExist(scrapedScene.SceneID)
+func IndexScenes(scenes *[]models.Scene) []string {
+	tlog := log.WithFields(logrus.Fields{"task": "scrape"})
+
+	idx, err := GetSceneIndex()
+	if err != nil {
+		log.Error(err)
+		return nil
+	}
+
+	tlog.Infof("Adding scraped scenes to search index...")
+
+	total := 0
+	lastMessage := time.Now()
+	write := func(batch *bleve.Batch) error {
+		if time.Since(lastMessage) > time.Duration(config.Config.Advanced.ProgressTimeInterval)*time.Second {
+			tlog.Infof("Indexed %v of %v scenes", total, len(*scenes))
+			lastMessage = time.Now()
+		}
+		err := idx.Batch(batch)
 		if err == nil {
-			scenes = append(scenes, scene)
+			total += batch.Size()
 		}
+		return err
+	}
+	indexed, failed := idx.indexScenes(*scenes, indexBatchSize(), write)
+	if len(failed) > 0 {
+		addFailedIndexScenes(failed)
+		tlog.Warnf("Indexed %v scenes, %v could not be indexed and will be retried later", indexed, len(failed))
+		return failed
 	}
 
-	// Now update search index
-	IndexScenes(&scenes)
+	tlog.Infof("Indexed %v scenes", indexed)
+	return nil
 }
 
+// ReindexScene refreshes the search document of a single scene from the db, unless the scene has not been saved
+// since it was indexed.
+// It does not take the "index" lock, so edits are searchable straight away even while a full rebuild is running.
+func ReindexScene(sceneID string) error {
+	idx, err := GetSceneIndex()
+	if err != nil {
+		return err
+	}
+
+	var scene models.Scene
+	if err := scene.GetIfExist(sceneID); err != nil {
+		return err
+	}
+
+	if idx.Current(scene) {
+		return nil
+	}
+	// indexing replaces the existing document in one write, searches never see the scene missing
+	return idx.PutScene(scene)
+}
+
+func DeleteIndexScenes(scenes *[]models.Scene) {
+	tlog := log.WithFields(logrus.Fields{"task": "scrape"})
+
+	idx, err := GetSceneIndex()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	tlog.Infof("Deleting scenes from search index...")
+
+	total := 0
+	lastMessage := time.Now()
+	for i := range *scenes {
+		if time.Since(lastMessage) > time.Duration(config.Config.Advanced.ProgressTimeInterval)*time.Second {
+			tlog.Infof("Deleted %v of %v scenes from search index", total, len(*scenes))
+			lastMessage = time.Now()
+		}
+		scene := (*scenes)[i]
+		if idx.Exist(scene.SceneID) {
+			if err := idx.DeleteScene(scene.SceneID); err != nil {
+				log.Error(err)
+			} else {
+				total += 1
+			}
+		}
+	}
+
+	tlog.Infof("Deleted %v scenes from search index", total)
+}
+
+/**
+ * Queue the specified scrapedScenes to be reindexed from the DB.
+ * Call FlushIndexQueue to wait for them to be written.
+ */
+func IndexScrapedScenes(scrapedScenes *[]models.ScrapedScene) {
+	for i := range *scrapedScenes {
+		QueueSceneIndex((*scrapedScenes)[i].SceneID)
+	}
+}
+
+// resolution, codec and format words removed from filenames, extended by config.Config.Advanced.FilenameStripWords
+var defaultFilenameStripWords = []string{
+	"180", "180x180", "2880x1440", "3d", "3dh", "3dv", "30fps", "30m", "360",
+	"3840x1920", "4k", "5k", "5400x2700", "60fps", "6k", "7k", "7680x3840",
+	"8k", "fb360", "fisheye190", "funscript", "cmscript", "h264", "h265", "hevc", "hq", "hsp", "lq", "lr",
+	"mkv", "mkx200", "mkx220", "mono", "mp4", "oculus", "oculus5k",
+	"oculusrift", "original", "rf52", "smartphone", "srt", "ssa", "tb", "uhq", "vrca220", "vp9",
+}
+
+// defaultFilenameSiteAliases are site names as they are written joined up in filenames, mapped case insensitively to
+// the site name scenes are indexed with. Names that only differ in case, eg WankzVR, already match and are not listed.
+var defaultFilenameSiteAliases = map[string]string{
+	"czechvr":        "Czech VR",
+	"czechvrcasting": "Czech VR Casting",
+	"czechvrfetish":  "Czech VR Fetish",
+	"realjamvr":      "RealJam VR",
+	"upclosevr":      "Up Close VR",
+}
+
+// normalizeSiteAliases replaces the words of a filename that are a known way of writing a site with the site name,
+// the configured aliases take precedence over the defaults
+func normalizeSiteAliases(words []string) []string {
+	aliases := map[string]string{}
+	for alias, site := range defaultFilenameSiteAliases {
+		aliases[alias] = site
+	}
+	for alias, site := range config.Config.Advanced.FilenameSiteAliases {
+		aliases[strings.ToLower(alias)] = site
+	}
+
+	normalized := make([]string, 0, len(words))
+	for _, w := range words {
+		if site, ok := aliases[strings.ToLower(w)]; ok && site != "" {
+			w = site
+		}
+		normalized = append(normalized, w)
+	}
+	return normalized
+}
+
+// splitCamelCase adds a space where a capital starts a new word, after a lowercase letter or at the end of an
+// acronym, so RileyReidPOVFuck becomes Riley Reid POV Fuck while POV and studio codes like PXVR258 stay together
+func splitCamelCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			if unicode.IsLower(prev) || (unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteRune(' ')
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// leadingDatePattern matches a YYYY-MM-DD or YYYYMMDD date, or a 10 digit unix time, followed by a separator
+var leadingDatePattern = regexp.MustCompile(`^((?:19|20)\d{2}[-._ ]?(?:0[1-9]|1[0-2])[-._ ]?(?:0[1-9]|[12]\d|3[01])|1\d{9})[-._ ]+`)
+
+// stripLeadingDates removes download dates and timestamps from the start of a filename, other numbers
+// such as numeric studio codes do not have the shape of a date and are kept
+func stripLeadingDates(name string) string {
+	for {
+		loc := leadingDatePattern.FindStringIndex(name)
+		if loc == nil || loc[1] == len(name) {
+			return name
+		}
+		name = name[loc[1]:]
+	}
+}
+
+// bracketPattern matches a [], () or {} block, eg [1080p] (VR) {SiteRip}
+var bracketPattern = regexp.MustCompile(`[\[({]([^\[\](){}]*)[\])}]`)
+
+// bracketJunkWords are only dropped inside brackets, outside them they may be part of a title
+var bracketJunkWords = []string{"vr", "sd", "hd", "fhd", "uhd", "rip", "siterip", "webrip", "web", "webdl", "x264", "x265"}
+
+var resolutionPattern = regexp.MustCompile(`^[0-9]+p$`)
+
+// isFilenameJunk reports whether a word of a filename is a strip word or a resolution such as 1080p
+func isFilenameJunk(word string, stripWords []string) bool {
+	for _, w := range stripWords {
+		if strings.EqualFold(word, w) {
+			return true
+		}
+	}
+	return resolutionPattern.MatchString(strings.ToLower(word))
+}
+
+// stripBrackets removes [] and {} blocks and () blocks holding only junk, eg [1080p] (VR) {SiteRip}. Blocks are
+// only removed when words are left outside them, a filename that is all brackets keeps their words, and so does
+// a () block with any other word in it, eg Title (Riley Reid).
+func stripBrackets(name string, stripWords []string) string {
+	junk := append(append([]string{}, stripWords...), bracketJunkWords...)
+	words := func(s string) []string {
+		return strings.FieldsFunc(s, func(r rune) bool { return strings.ContainsRune("._+- ", r) })
+	}
+	allJunk := func(s string) bool {
+		for _, w := range words(s) {
+			if !isFilenameJunk(w, junk) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if allJunk(bracketPattern.ReplaceAllString(name, " ")) {
+		return bracketPattern.ReplaceAllString(name, " $1 ")
+	}
+	return bracketPattern.ReplaceAllStringFunc(name, func(block string) string {
+		content := block[1 : len(block)-1]
+		if block[0] == '(' && !allJunk(content) {
+			return " " + content + " "
+		}
+		return " "
+	})
+}
+
+// truncateOnWord cuts s to at most max characters, at the end of the last whole word that fits. A word longer than
+// max is cut where it reaches max. A max of 0 or less keeps all of s.
+func truncateOnWord(s string, max int) string {
+	runes := []rune(s)
+	if max <= 0 || len(runes) <= max {
+		return s
+	}
+	cut := runes[:max]
+	if !unicode.IsSpace(runes[max]) {
+		for i := len(cut) - 1; i > 0; i-- {
+			if unicode.IsSpace(cut[i]) {
+				cut = cut[:i]
+				break
+			}
+		}
+	}
+	return strings.TrimRightFunc(string(cut), unicode.IsSpace)
+}
+
+// possessivePattern matches an s joined to the word before it by a separator, and the separator or end after it
+var possessivePattern = regexp.MustCompile(`(\pL)[._-]s([._+ -]|$)`)
+
+// CleanFilename turns a video filename into search words, release codes found in it are followed by
+// their other spellings so scenes using any of them match
 func CleanFilename(filename string) string {
-	commonWords := []string{
-		"180", "180x180", "2880x1440", "3d", "3dh", "3dv", "30fps", "30m", "360",
-		"3840x1920", "4k", "5k", "5400x2700", "60fps", "6k", "7k", "7680x3840",
-		"8k", "fb360", "fisheye190", "funscript", "cmscript", "h264", "h265", "hevc", "hq", "hsp", "lq", "lr",
-		"mkv", "mkx200", "mkx220", "mono", "mp4", "oculus", "oculus5k",
-		"oculusrift", "original", "rf52", "smartphone", "srt", "ssa", "tb", "uhq", "vrca220", "vp9",
+	result, codes := CleanFilenameWithCode(filename)
+	for _, code := range codes {
+		if !strings.Contains(result, code) {
+			result = result + " " + code
+		}
 	}
+	return result
+}
+
+// CleanFilenameWithCode returns the search words of a filename and, separately, the JAVR-style release codes
+// found in it, eg PXVR258, each followed by its variants such as PXVR-258 and PXVR00258
+func CleanFilenameWithCode(filename string) (cleaned string, codes []string) {
+	commonWords := append(append([]string{}, defaultFilenameStripWords...), config.Config.Advanced.FilenameStripWords...)
 
 	// Remove extension
 	ext := filepath.Ext(filename)
 	name := strings.TrimSuffix(filename, ext)
+	original := name
+
+	name = stripLeadingDates(name)
+	name = stripBrackets(name, commonWords)
+
+	// Restore possessives written with a separator instead of the apostrophe, eg Riley_s_Best, before the
+	// separators become spaces. A standalone s between spaces is left alone, eg Studio s Best.
+	name = possessivePattern.ReplaceAllString(name, "$1's$2")
 
 	// Replace characters with spaces
 	re := regexp.MustCompile(`[._+-]`)
@@ -289,78 +1179,505 @@ func CleanFilename(filename string) string {
 	name = re.ReplaceAllString(name, " ")
 	name = strings.TrimSpace(name)
 
+	// Split joined words, eg RileyReidPOV
+	name = splitCamelCase(name)
+
 	// Filter common words
 	parts := strings.Split(name, " ")
 	var filtered []string
-	resP := regexp.MustCompile(`^[0-9]+p$`)
 	for _, p := range parts {
-		isCommon := false
-		for _, cw := range commonWords {
-			if strings.EqualFold(p, cw) {
-				isCommon = true
-				break
-			}
-		}
-		if !isCommon && !resP.MatchString(strings.ToLower(p)) {
+		if !isFilenameJunk(p, commonWords) {
 			filtered = append(filtered, p)
 		}
 	}
 
-	result := strings.Join(filtered, " ")
-	result = strings.ReplaceAll(result, " s ", "'s ")
+	cleaned = strings.Join(normalizeSiteAliases(filtered), " ")
+
+	seen := map[string]bool{}
+	addCode := func(code string) {
+		if !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
 
 	// Detect JAVR-style patterns like "PXVR 258" or "SAVR 883" and add variations
 	javrPattern := regexp.MustCompile(`([a-zA-Z]+)\s+([0-9]+)`)
-	matches := javrPattern.FindAllStringSubmatch(result, -1)
-
-	for _, match := range matches {
-		if len(match) == 3 {
-			prefix := match[1]
-			numStr := match[2]
-
-			// Add zero-padded version (e.g., PXVR00258)
-			num, err := strconv.Atoi(numStr)
-			if err == nil {
-				padded := fmt.Sprintf("%s%05d", prefix, num)
-				if !strings.Contains(result, padded) {
-					result = result + " " + padded
-				}
+	for _, match := range javrPattern.FindAllStringSubmatch(cleaned, -1) {
+		prefix := match[1]
+		numStr := match[2]
+
+		addCode(match[0])
+		// Add zero-padded version (e.g., PXVR00258)
+		if num, err := strconv.Atoi(numStr); err == nil {
+			addCode(fmt.Sprintf("%s%05d", prefix, num))
+		}
+		// Add simple concatenated version (e.g., PXVR258)
+		addCode(prefix + numStr)
+	}
+
+	// Codes written without a separator like "PXVR258"
+	javrConcatPattern := regexp.MustCompile(`^([a-zA-Z]{2,6})([0-9]{2,5})$`)
+	for _, p := range filtered {
+		match := javrConcatPattern.FindStringSubmatch(p)
+		if match == nil {
+			continue
+		}
+		prefix := match[1]
+		numStr := match[2]
+
+		addCode(p)
+		addCode(prefix + "-" + numStr)
+		addCode(prefix + " " + numStr)
+		if num, err := strconv.Atoi(numStr); err == nil {
+			addCode(fmt.Sprintf("%s%05d", prefix, num))
+		}
+	}
+
+	// Configured code styles are matched before separators are replaced, eg 3DSVR-1234
+	for _, p := range config.Config.Advanced.FilenameCodePatterns {
+		// invalid patterns are rejected when the options are saved
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			continue
+		}
+		for _, match := range re.FindAllStringSubmatchIndex(original, -1) {
+			for _, v := range p.Variants {
+				addCode(string(re.ExpandString(nil, v, original, match)))
 			}
+		}
+	}
+
+	return cleaned, codes
+}
+
+const (
+	defaultSearchPageSize = 25
+	// MaxSearchPageSize is the most results a single search returns, larger requests are clamped
+	// and flagged as Truncated so a caller cannot pull the whole index into memory by accident
+	MaxSearchPageSize = 1000
+)
+
+// searchPageSize is the number of results returned when the caller does not ask for a size, set by config.Config.Web.SearchPageSize
+func searchPageSize() int {
+	size := config.Config.Web.SearchPageSize
+	if size <= 0 {
+		return defaultSearchPageSize
+	}
+	if size > MaxSearchPageSize {
+		return MaxSearchPageSize
+	}
+	return size
+}
+
+// SceneSearchOptions controls paging and the optional, more expensive parts of a search
+type SceneSearchOptions struct {
+	Offset        int
+	Size          int
+	Mode          SearchMode
+	SortBy        []string // a preset name or sort fields, eg -released or -added, defaults to the best matches first
+	Highlight     bool     // return the matching title and description fragments in Scene.SearchHighlights
+	Facets        bool     // count the matching scenes per site, tag, cast member and release year
+	RecencyWeight float64  // rank newer scenes higher among similar matches, 0 ranks by the text match alone
+	TotalDuration bool     // add up the duration of every match in SceneSearchResult.TotalDuration, not only this page
+	MatchedFields bool     // return the fields each scene matched in Scene.MatchedFields, eg cast or title
+	// a query without any text returns the most recently added scenes, in the SortBy order if one is given,
+	// rather than no scenes
+	RecentWhenEmpty bool
+	// include the scenes of the sites in config.Config.Web.SearchExcludeSites, for admin tools
+	IncludeExcludedSites bool
+	// the tags and sites the user searching may see, nil for every scene
+	ContentFilter *SceneContentFilter
+	// leave out the matches scoring below this, eg the long tail of fuzzy matches, 0 keeps every match
+	MinScore float64
+	// only search within the favourite or wishlist scenes
+	FavouriteOnly bool
+	WishlistOnly  bool
+}
+
+type SceneSearchResult struct {
+	Scenes     []models.Scene
+	Total      uint64
+	Rebuilding bool                     // the index is being rebuilt, results may be incomplete
+	Truncated  bool                     // more results were requested than MaxSearchPageSize
+	Facets     map[string][]SearchFacet // keyed by site, tags, cast and year, only when requested
+	// minutes, of every match rather than this page, only when requested. Scenes without a duration add nothing.
+	TotalDuration int
+	// "did you mean" corrections of a text search that matched nothing, the closest first
+	Suggestions []string
+}
+
+// SearchFacet is the number of matching scenes with a site, tag or cast member.
+// Cast names are lowercase as they come from the case insensitive cast_exact field.
+type SearchFacet struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+const searchFacetSize = 20
+
+// firstFacetYear is the earliest release year counted by the year facet, there are next to no VR scenes before it
+const firstFacetYear = 2010
+
+// yearFacetRequest counts the matching scenes released in each year up to the next one, scenes without a release
+// date are not counted
+func yearFacetRequest(now time.Time) *bleve.FacetRequest {
+	facet := bleve.NewFacetRequest("year", searchFacetSize)
+	for year := firstFacetYear; year <= now.Year()+1; year++ {
+		min, max := float64(year), float64(year+1)
+		facet.AddNumericRange(strconv.Itoa(year), &min, &max)
+	}
+	return facet
+}
+
+// sceneFacetFields maps the facet names to the unanalysed fields they count
+var sceneFacetFields = map[string]string{
+	"site": "site_exact",
+	"tags": "tags_exact",
+	"cast": "cast_exact",
+}
+
+// FuzzySearchScenes returns the best matches for a query string search. No matches is an empty result,
+// an error wrapping ErrSearchIndexUnavailable means the index could not be opened or searched, eg it is damaged.
+func FuzzySearchScenes(q string) ([]models.Scene, error) {
+	scenes, _, err := FuzzySearchScenesPaged(q, 0, searchPageSize())
+	return scenes, err
+}
+
+// ScoredScene is a search match with its score beside the scene
+type ScoredScene struct {
+	Scene models.Scene
+	Score float64
+}
+
+// FuzzySearchScenesScored returns the first page of results best first, like FuzzySearchScenes, with their scores
+// and the best score, so callers can compare the matches with each other, eg only auto-match a file when the best
+// score is twice the second
+func FuzzySearchScenesScored(q string) ([]ScoredScene, float64, error) {
+	scenes, err := FuzzySearchScenes(q)
+	if err != nil {
+		return nil, 0, err
+	}
+	scored, max := scoredScenes(scenes)
+	return scored, max, nil
+}
+
+func scoredScenes(scenes []models.Scene) ([]ScoredScene, float64) {
+	scored := make([]ScoredScene, 0, len(scenes))
+	max := 0.0
+	for _, scene := range scenes {
+		scored = append(scored, ScoredScene{Scene: scene, Score: scene.Score})
+		if scene.Score > max {
+			max = scene.Score
+		}
+	}
+	return scored, max
+}
+
+// FuzzySearchScenesSorted returns the first page of results in the given order, see SceneSearchOptions.SortBy
+func FuzzySearchScenesSorted(q string, sortBy []string) ([]models.Scene, error) {
+	result, err := FuzzySearchScenesWithOptions(q, SceneSearchOptions{SortBy: sortBy})
+	return result.Scenes, err
+}
+
+// FuzzySearchScenesPaged returns one page of search results along with the total number of matches
+func FuzzySearchScenesPaged(q string, offset int, size int) ([]models.Scene, uint64, error) {
+	result, err := FuzzySearchScenesWithOptions(q, SceneSearchOptions{Offset: offset, Size: size})
+	return result.Scenes, result.Total, err
+}
 
-			// Add simple concatenated version (e.g., PXVR258)
-			simple := prefix + numStr
-			if !strings.Contains(result, simple) {
-				result = result + " " + simple
+func FuzzySearchScenesWithOptions(q string, opts SceneSearchOptions) (SceneSearchResult, error) {
+	filter := SceneSearchFilter{FavouriteOnly: opts.FavouriteOnly, WishlistOnly: opts.WishlistOnly}
+	if strings.TrimSpace(q) == "" {
+		if !opts.RecentWhenEmpty {
+			return SceneSearchResult{Scenes: []models.Scene{}}, nil
+		}
+		if filter.FavouriteOnly || filter.WishlistOnly {
+			return searchScenes(filteredQuery("", opts.Mode, filter), recentSceneOptions(opts))
+		}
+		return searchScenes(bleve.NewMatchAllQuery(), recentSceneOptions(opts))
+	}
+	idx, err := GetSceneIndex()
+	if err != nil {
+		return SceneSearchResult{}, fmt.Errorf("%w: %v", ErrSearchIndexUnavailable, err)
+	}
+	// a whole scene id returns that scene rather than every scene sharing words with it. A prefix search still lists
+	// every id starting with it.
+	if opts.Mode != SearchModePrefix {
+		if result, ok := idx.exactSceneResult(q, opts); ok {
+			return result, nil
+		}
+	}
+	result, err := searchScenes(filteredQuery(q, opts.Mode, filter), opts)
+	// the term dictionary is only walked when there is nothing else to show, and not for a user with a content filter
+	// as it holds the words of scenes they may not see
+	if err == nil && result.Total == 0 && opts.ContentFilter == nil {
+		if result.Suggestions, err = idx.suggestions(q); err != nil {
+			log.Error(err)
+			err = nil
+		}
+	}
+	return result, err
+}
+
+// recentSceneOptions sorts the scenes of an empty search by when they were added, newest first
+func recentSceneOptions(opts SceneSearchOptions) SceneSearchOptions {
+	if len(opts.SortBy) == 0 || (len(opts.SortBy) == 1 && opts.SortBy[0] == "relevance") {
+		opts.SortBy = []string{"-added", "-_id"}
+	}
+	return opts
+}
+
+// FuzzySearchScenesTolerant matches the words of q against the title and cast allowing for misspellings,
+// words of five or more characters may be up to fuzziness edits away, a negative fuzziness uses the default of 1
+func FuzzySearchScenesTolerant(q string, fuzziness int) ([]models.Scene, error) {
+	result, err := searchScenes(tolerantQuery(q, fuzziness), SceneSearchOptions{})
+	return result.Scenes, err
+}
+
+// MatchFilenameToScenes returns the best scene candidates for a video file, ranked by Score.
+// Release codes in the filename that match a scene id or title rank that scene first.
+func MatchFilenameToScenes(filename string) ([]models.Scene, error) {
+	clean := CleanFilename(filename)
+	if clean == "" {
+		return nil, nil
+	}
+	result, err := searchScenes(filenameQuery(clean), SceneSearchOptions{})
+	return result.Scenes, err
+}
+
+// FindScenesByIDPrefix returns the scenes whose id starts with prefix, sorted by id. The prefix is case sensitive
+// and matched against the whole id, eg slr-1 matches slr-1234 but not vrb-slr-1.
+func FindScenesByIDPrefix(prefix string) ([]models.Scene, error) {
+	result, err := searchScenes(idPrefixQuery(prefix), SceneSearchOptions{SortBy: []string{"_id"}})
+	return result.Scenes, err
+}
+
+// SearchScenesByCast finds scenes with all of the cast members when matchAll is set, otherwise with any of them.
+// Each name is matched as a full name, eg Riley Reid does not match Riley Steele.
+func SearchScenesByCast(names []string, matchAll bool) ([]models.Scene, error) {
+	result, err := searchScenes(castNamesQuery(names, matchAll), SceneSearchOptions{})
+	return result.Scenes, err
+}
+
+// SearchScenesByTagGroups finds scenes matching every group of tags, eg (pov or solo) and blonde, see TagGroup
+func SearchScenesByTagGroups(groups []TagGroup) ([]models.Scene, error) {
+	result, err := searchScenes(tagGroupsQuery(groups), SceneSearchOptions{})
+	return result.Scenes, err
+}
+
+// sceneSortFields maps sort names to the indexed field they sort on, "added" sorts on the exact time
+// rather than the date only added field
+var sceneSortFields = map[string]string{
+	"added": "added_at",
+	"size":  "file_size",
+}
+
+// SceneSortPresets are the named sort orders offered in the UI
+var SceneSortPresets = map[string][]string{
+	"relevance": {"-_score"},
+	"newest":    {"-released", "-_score"},
+	"longest":   {"-duration", "-_score"},
+	"rating":    {"-rating", "-_score"},
+	"largest":   {"-file_size", "-_score"},
+}
+
+// sceneSortOrder resolves presets and sort names to the bleve sort order, followed by the tie breakers
+func sceneSortOrder(m mapping.IndexMapping, sortBy []string) []string {
+	return withTieBreakers(requestedSortOrder(m, sortBy))
+}
+
+// withTieBreakers orders scenes the sort keeps equal, eg with the same score, by release date then id. Without them
+// their order can change between searches, so a page can repeat or skip scenes of the one before.
+func withTieBreakers(order []string) []string {
+	hasKey := func(key string) bool {
+		for _, o := range order {
+			if strings.TrimPrefix(o, "-") == key {
+				return true
 			}
 		}
+		return false
 	}
+	// ids are unique, nothing sorts after them
+	if hasKey("_id") {
+		return order
+	}
+	order = append([]string{}, order...)
+	if !hasKey("released") {
+		order = append(order, "-released")
+	}
+	return append(order, "_id")
+}
 
-	return result
+// requestedSortOrder resolves presets and sort names to the bleve sort order,
+// any field not in the index mapping falls back to sorting by score
+func requestedSortOrder(m mapping.IndexMapping, sortBy []string) []string {
+	if len(sortBy) == 1 {
+		if preset, ok := SceneSortPresets[sortBy[0]]; ok {
+			return preset
+		}
+	}
+	if len(sortBy) == 0 {
+		return []string{"-_score"}
+	}
+	order := make([]string, 0, len(sortBy))
+	for _, s := range sortBy {
+		desc := strings.HasPrefix(s, "-")
+		field := strings.TrimPrefix(s, "-")
+		if mapped, ok := sceneSortFields[field]; ok {
+			field = mapped
+		}
+		if field != "_score" && field != "_id" && m.FieldMappingForPath(field).Type == "" {
+			return []string{"-_score"}
+		}
+		if desc {
+			field = "-" + field
+		}
+		order = append(order, field)
+	}
+	return order
+}
+
+func newSceneSearchRequest(m mapping.IndexMapping, q query.Query, opts SceneSearchOptions) *bleve.SearchRequest {
+	offset := opts.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	size := opts.Size
+	if size <= 0 {
+		size = searchPageSize()
+	}
+	if size > MaxSearchPageSize {
+		size = MaxSearchPageSize
+	}
+
+	searchRequest := bleve.NewSearchRequest(withRecencyBoost(q, opts.RecencyWeight, time.Now()))
+	searchRequest.Fields = []string{"Id", "title", "cast", "tags", "site", "studio", "description"}
+	searchRequest.From = offset
+	searchRequest.Size = size
+	searchRequest.SortBy(sceneSortOrder(m, opts.SortBy))
+	if opts.Highlight {
+		searchRequest.Highlight = bleve.NewHighlight()
+		searchRequest.Highlight.AddField("title")
+		searchRequest.Highlight.AddField("description")
+	}
+	searchRequest.IncludeLocations = opts.MatchedFields
+	if opts.Facets {
+		for name, field := range sceneFacetFields {
+			searchRequest.AddFacet(name, bleve.NewFacetRequest(field, searchFacetSize))
+		}
+		searchRequest.AddFacet("year", yearFacetRequest(time.Now()))
+	}
+	return searchRequest
 }
 
-func FuzzySearchScenes(q string) []models.Scene {
+// searchScenes runs the query against the scene index and loads the matching scenes from the db
+func searchScenes(q query.Query, opts SceneSearchOptions) (SceneSearchResult, error) {
+	var result SceneSearchResult
+
 	db, _ := models.GetDB()
 	defer db.Close()
 
-	idx, err := NewIndex("scenes")
+	idx, err := GetSceneIndex()
 	if err != nil {
-		return nil
+		return result, fmt.Errorf("%w: %v", ErrSearchIndexUnavailable, err)
 	}
-	defer idx.Bleve.Close()
 
-	query := bleve.NewQueryStringQuery(q)
-	searchRequest := bleve.NewSearchRequest(query)
-	searchRequest.Fields = []string{"Id", "title", "cast", "site", "description"}
-	searchRequest.Size = 25
-	searchRequest.SortBy([]string{"-_score"})
+	if !opts.IncludeExcludedSites {
+		q = withoutSites(q, config.Config.Web.SearchExcludeSites)
+	}
+	if opts.ContentFilter != nil {
+		q = opts.ContentFilter.restrict(q)
+	}
 
-	searchResults, err := idx.Bleve.Search(searchRequest)
+	result.Rebuilding = SceneIndexRebuilding()
+	result.Truncated = opts.Size > MaxSearchPageSize
+	idx, searchResults, err := searchSceneIndex(newSceneSearchRequest(idx.Bleve.Mapping(), q, opts))
 	if err != nil {
-		return nil
+		return result, fmt.Errorf("%w: %v", ErrSearchIndexUnavailable, err)
+	}
+
+	if opts.MinScore > 0 {
+		order := sceneSortOrder(idx.Bleve.Mapping(), opts.SortBy)
+		dropWeakHits(searchResults, opts.MinScore, opts.Offset, order[0] == "-_score")
+	}
+
+	result.Scenes = ScenesFromSearchResult(searchResults)
+	result.Total = searchResults.Total
+
+	if opts.Facets {
+		result.Facets = make(map[string][]SearchFacet, len(searchResults.Facets))
+		for name, facet := range searchResults.Facets {
+			terms := []SearchFacet{}
+			for _, t := range facet.Terms.Terms() {
+				terms = append(terms, SearchFacet{Term: t.Term, Count: t.Count})
+			}
+			for _, r := range facet.NumericRanges {
+				terms = append(terms, SearchFacet{Term: r.Name, Count: r.Count})
+			}
+			result.Facets[name] = terms
+		}
+	}
+
+	if opts.TotalDuration {
+		if result.TotalDuration, err = idx.totalDuration(q); err != nil {
+			return result, fmt.Errorf("%w: %v", ErrSearchIndexUnavailable, err)
+		}
 	}
 
+	return result, nil
+}
+
+// dropWeakHits removes the hits scoring below minScore before their scenes are loaded. Bleve can't leave them out
+// itself, so only this page is filtered. When the hits are sorted by score the weak ones are the last, once one is
+// found Total is the matches before it, otherwise Total still counts weak matches on other pages.
+func dropWeakHits(res *bleve.SearchResult, minScore float64, offset int, byScore bool) {
+	hits := res.Hits[:0]
+	for _, hit := range res.Hits {
+		if hit.Score >= minScore {
+			hits = append(hits, hit)
+		}
+	}
+	if byScore && len(hits) < len(res.Hits) {
+		res.Total = uint64(offset + len(hits))
+	}
+	res.Hits = hits
+}
+
+// totalDuration adds up the duration of every scene matching q. Bleve has no sum aggregation, so the matches are
+// walked in pages loading only the duration, without scoring them.
+func (i *Index) totalDuration(q query.Query) (int, error) {
+	total := 0
+
+	req := bleve.NewSearchRequestOptions(q, 1000, 0, false)
+	req.Fields = []string{"duration"}
+	req.Score = "none"
+	req.SortBy([]string{"_id"})
+	for {
+		res, err := i.Bleve.Search(req)
+		if err != nil {
+			return 0, err
+		}
+		for _, hit := range res.Hits {
+			// numbers are returned as float64, a scene indexed without a duration has no value
+			if d, ok := hit.Fields["duration"].(float64); ok && d > 0 {
+				total += int(d)
+			}
+		}
+		if len(res.Hits) < req.Size {
+			break
+		}
+		req.SearchAfter = []string{res.Hits[len(res.Hits)-1].ID}
+	}
+
+	return total, nil
+}
+
+// ScenesFromSearchResult loads the scenes of the hits from the db in the order of the hits, with their Score and any
+// highlighted fragments. Hits for scenes no longer in the db are skipped.
+func ScenesFromSearchResult(res *bleve.SearchResult) []models.Scene {
 	var scenes []models.Scene
-	for _, v := range searchResults.Hits {
+	for _, v := range res.Hits {
 		var scene models.Scene
 		err := scene.GetIfExist(v.ID)
 		if err != nil {
@@ -368,8 +1685,174 @@ func FuzzySearchScenes(q string) []models.Scene {
 		}
 
 		scene.Score = v.Score
+		scene.SearchHighlights = v.Fragments
+		scene.MatchedFields = matchedFields(v)
 		scenes = append(scenes, scene)
 	}
-
 	return scenes
 }
+
+// matchedFieldNames maps the fields a search can match to the names shown for them, the combined searchable field
+// is left out as the boosted field queries report which of its parts matched
+var matchedFieldNames = map[string]string{
+	"searchable": "",
+	"cast_exact": "cast",
+	"tags_exact": "tags",
+	"site_exact": "site",
+	"id_exact":   "id",
+}
+
+// matchedFields lists the fields a hit matched in, sorted by name, when the search included term locations
+func matchedFields(hit *search.DocumentMatch) []string {
+	seen := map[string]bool{}
+	var fields []string
+	for field := range hit.Locations {
+		if name, ok := matchedFieldNames[field]; ok {
+			field = name
+		}
+		if field != "" && !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// SearchRaw runs a search request built by the caller against the scene index, for boosts and queries the other
+// search functions don't offer. Field names in the request must match the index mapping, see the json names of
+// SceneIndexed, a field that is not mapped matches nothing rather than failing. Pass the result to
+// ScenesFromSearchResult to load the scenes. The sites excluded from searches are not left out.
+func SearchRaw(req *bleve.SearchRequest) (*bleve.SearchResult, error) {
+	_, res, err := searchSceneIndex(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSearchIndexUnavailable, err)
+	}
+	return res, nil
+}
+
+// SceneSummary is a search hit built from the fields stored in the index, enough to list suggestions
+// without loading each scene from the db
+type SceneSummary struct {
+	SceneID  string   `json:"scene_id"`
+	Title    string   `json:"title"`
+	Cast     []string `json:"cast"`
+	Site     string   `json:"site"`
+	CoverURL string   `json:"cover_url"`
+	Score    float64  `json:"score"`
+}
+
+// SearchSceneSummaries runs the query string search and returns the first page of hits from the index alone,
+// use FuzzySearchScenes when the full scenes are needed
+func SearchSceneSummaries(q string) ([]SceneSummary, error) {
+	idx, err := GetSceneIndex()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSearchIndexUnavailable, err)
+	}
+
+	sq := withoutSites(textQuery(q, SearchModeQueryString), config.Config.Web.SearchExcludeSites)
+	searchRequest := newSceneSearchRequest(idx.Bleve.Mapping(), sq, SceneSearchOptions{})
+	searchRequest.Fields = []string{"title", "cast_exact", "site", "cover_url"}
+	_, searchResults, err := searchSceneIndex(searchRequest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSearchIndexUnavailable, err)
+	}
+
+	summaries := []SceneSummary{}
+	for _, v := range searchResults.Hits {
+		summaries = append(summaries, sceneSummary(v))
+	}
+	return summaries, nil
+}
+
+func sceneSummary(hit *search.DocumentMatch) SceneSummary {
+	summary := SceneSummary{SceneID: hit.ID, Score: hit.Score}
+	summary.Title, _ = hit.Fields["title"].(string)
+	summary.Site, _ = hit.Fields["site"].(string)
+	summary.CoverURL, _ = hit.Fields["cover_url"].(string)
+	// a field with several values is returned as a slice, a single value as is
+	switch cast := hit.Fields["cast_exact"].(type) {
+	case string:
+		summary.Cast = []string{cast}
+	case []interface{}:
+		for _, name := range cast {
+			if s, ok := name.(string); ok {
+				summary.Cast = append(summary.Cast, s)
+			}
+		}
+	}
+	return summary
+}
+
+const castSuggestionLimit = 10
+
+// SuggestCast returns up to 10 names of cast members starting with prefix, for completing a cast filter as it is typed.
+// Names credited in the most scenes come first, the whole name is matched so "riley r" suggests Riley Reid.
+func SuggestCast(prefix string) ([]string, error) {
+	prefix = normalizedName(prefix)
+	if prefix == "" {
+		return nil, nil
+	}
+
+	idx, err := GetSceneIndex()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSearchIndexUnavailable, err)
+	}
+	terms, err := idx.castSuggestions(prefix, castSuggestionLimit)
+	if err != nil || len(terms) == 0 {
+		return nil, err
+	}
+
+	// cast_exact is lowercase, the names are shown as they are spelt in the db
+	db, _ := models.GetDB()
+	defer db.Close()
+	var names []string
+	db.Model(&models.Actor{}).Where("lower(name) in (?)", terms).Pluck("name", &names)
+	spelling := make(map[string]string, len(names))
+	for _, name := range names {
+		spelling[strings.ToLower(name)] = name
+	}
+
+	suggestions := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if name, ok := spelling[term]; ok {
+			term = name
+		}
+		suggestions = append(suggestions, term)
+	}
+	return suggestions, nil
+}
+
+// castSuggestions reads the cast_exact terms starting with prefix from the index dictionary, which is much cheaper
+// than a search, and returns the limit terms found in the most scenes
+func (i *Index) castSuggestions(prefix string, limit int) ([]string, error) {
+	dict, err := i.Bleve.FieldDictPrefix("cast_exact", []byte(prefix))
+	if err != nil {
+		return nil, err
+	}
+	defer dict.Close()
+
+	var entries []index.DictEntry
+	for {
+		entry, err := dict.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		entries = append(entries, *entry)
+	}
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].Count > entries[b].Count
+	})
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	terms := make([]string, len(entries))
+	for n, entry := range entries {
+		terms[n] = entry.Term
+	}
+	return terms, nil
+}
@@ -0,0 +1,85 @@
+package tasks
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/document"
+	"github.com/xbapps/xbvr/pkg/config"
+	"github.com/xbapps/xbvr/pkg/models"
+)
+
+// indexWorkers is the number of goroutines building documents during a full index build
+func indexWorkers() int {
+	if config.Config.Advanced.SearchIndexWorkers > 0 {
+		return config.Config.Advanced.SearchIndexWorkers
+	}
+	return runtime.NumCPU()
+}
+
+// sceneBatcher collects documents from several workers into one batch, which is written whenever it is full.
+// Documents are mapped before the batch is locked, so only appending to the batch and writing it are serialised.
+type sceneBatcher struct {
+	idx  *Index
+	size int
+
+	mu    sync.Mutex
+	batch *bleve.Batch
+}
+
+func newSceneBatcher(idx *Index, size int) *sceneBatcher {
+	return &sceneBatcher{idx: idx, size: size, batch: idx.Bleve.NewBatch()}
+}
+
+func (b *sceneBatcher) add(scene models.Scene) error {
+	doc := document.NewDocument(scene.SceneID)
+	if err := b.idx.Bleve.Mapping().MapDocument(doc, sceneDocument(scene)); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.batch.IndexAdvanced(doc); err != nil {
+		return err
+	}
+	if b.batch.Size() < b.size {
+		return nil
+	}
+	err := b.idx.Batch(b.batch)
+	b.batch.Reset()
+	return err
+}
+
+// flush writes the documents left in the batch, it must only be called once the workers have stopped
+func (b *sceneBatcher) flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.batch.Size() == 0 {
+		return nil
+	}
+	err := b.idx.Batch(b.batch)
+	b.batch.Reset()
+	return err
+}
+
+// indexSceneWorkers starts workers adding the scenes sent on the channel to the batcher, skip reports the scenes
+// that are already indexed. The returned WaitGroup is done once the channel is closed and drained.
+func indexSceneWorkers(b *sceneBatcher, workers int, scenes <-chan models.Scene, skip func(models.Scene) bool) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for scene := range scenes {
+				if skip != nil && skip(scene) {
+					continue
+				}
+				if err := b.add(scene); err != nil {
+					log.Error(err)
+				}
+			}
+		}()
+	}
+	return &wg
+}
@@ -0,0 +1,108 @@
+package tasks
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xbapps/xbvr/pkg/models"
+)
+
+// searchIndexWatermarkKey is the KV entry holding the UpdatedAt of the newest scene IndexChanged has indexed
+const searchIndexWatermarkKey = "search_index_watermark"
+
+// IndexChangedSince reindexes the scenes updated since t and returns when it started, to pass as t to the next run,
+// or t when it was skipped. Deleted scenes are not found this way, they are removed by PruneDeletedScenes.
+func IndexChangedSince(t time.Time) (time.Time, error) {
+	tlog := log.WithFields(logrus.Fields{"task": "scrape"})
+
+	// a full index run is already reading every scene
+	if models.CheckLock("index") {
+		tlog.Infof("Search index is being built, skipping changed scenes")
+		return t, nil
+	}
+	if models.CheckLock("index-changed") {
+		tlog.Infof("Changed scenes are already being indexed")
+		return t, nil
+	}
+	models.CreateLock("index-changed")
+	defer models.RemoveLock("index-changed")
+
+	db, _ := models.GetDB()
+	defer db.Close()
+
+	// scenes saved after this are left to the next run, even when this one reads them too
+	started := time.Now()
+	total := 0
+	changed := 0
+	var lastID uint
+	tx := db.Model(models.Scene{}).Preload("Cast").Preload("Tags").Preload("Files").
+		Where("updated_at >= ?", t).Order("id")
+	tx.Count(&changed)
+	progress := newIndexProgress("changed")
+	for {
+		var scenes []models.Scene
+		if err := tx.Where("id > ?", lastID).Limit(100).Find(&scenes).Error; err != nil {
+			return t, err
+		}
+		if len(scenes) == 0 {
+			break
+		}
+		lastID = scenes[len(scenes)-1].ID
+
+		// a rebuild may have swapped the index since the last page
+		idx, err := GetSceneIndex()
+		if err != nil {
+			return t, err
+		}
+		batcher := newSceneBatcher(idx, indexBatchSize())
+		for i := range scenes {
+			if err := batcher.add(scenes[i]); err != nil {
+				return t, err
+			}
+		}
+		if err := batcher.flush(); err != nil {
+			return t, err
+		}
+		total += len(scenes)
+		progress.update(total, changed, fmt.Sprintf("Indexed %v/%v changed scenes", total, changed))
+	}
+
+	tlog.Infof("Indexed %v scenes changed since %v", total, t.Format(time.RFC3339))
+	progress.done(total, fmt.Sprintf("Indexed %v changed scenes", total))
+	return started, nil
+}
+
+// IndexChanged reindexes the scenes changed since the last run and prunes deleted ones, the first run indexes every
+// scene. Scenes a scrape could not index are retried too. The watermark is only saved once the changes are indexed,
+// so a failed run is retried from the same point.
+func IndexChanged() {
+	var kv models.KV
+	var since time.Time
+
+	db, _ := models.GetDB()
+	db.Where(&models.KV{Key: searchIndexWatermarkKey}).First(&kv)
+	db.Close()
+	if kv.Value != "" {
+		if t, err := time.Parse(time.RFC3339Nano, kv.Value); err == nil {
+			since = t
+		}
+	}
+
+	watermark, err := IndexChangedSince(since)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if _, err := PruneDeletedScenes(false); err != nil {
+		log.Error(err)
+	}
+	if err := RetryFailedIndexScenes(); err != nil {
+		log.Error(err)
+	}
+
+	if watermark.After(since) {
+		kv = models.KV{Key: searchIndexWatermarkKey, Value: watermark.Format(time.RFC3339Nano)}
+		kv.Save()
+	}
+}
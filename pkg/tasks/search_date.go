@@ -0,0 +1,156 @@
+package tasks
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xbapps/xbvr/pkg/config"
+)
+
+// dateOrder is the order of the day, month and year in a numeric date, eg "dmy" for 03/04/2024 being 3 April
+type dateOrder string
+
+const (
+	dateOrderDMY dateOrder = "dmy"
+	dateOrderMDY dateOrder = "mdy"
+	dateOrderYMD dateOrder = "ymd"
+)
+
+// localeDateOrders lists the locales not writing the day first, by full tag or language
+var localeDateOrders = map[string]dateOrder{
+	"en-us": dateOrderMDY,
+	"en-ph": dateOrderMDY,
+	"fil":   dateOrderMDY,
+	"ja":    dateOrderYMD,
+	"ko":    dateOrderYMD,
+	"zh":    dateOrderYMD,
+	"hu":    dateOrderYMD,
+	"lt":    dateOrderYMD,
+}
+
+var numericDateRegex = regexp.MustCompile(`^(\d{1,4})([./-])(\d{1,2})([./-])(\d{1,4})$`)
+
+// dates with a month name can be read the same in any locale
+var namedMonthLayouts = []string{
+	"2 Jan 2006",
+	"2 January 2006",
+	"Jan 2 2006",
+	"January 2 2006",
+}
+
+// localeDateOrder returns how numeric dates are written in the locale, false for an empty locale
+func localeDateOrder(locale string) (dateOrder, bool) {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	if locale == "" {
+		return "", false
+	}
+	if order, ok := localeDateOrders[locale]; ok {
+		return order, true
+	}
+	if order, ok := localeDateOrders[strings.SplitN(locale, "-", 2)[0]]; ok {
+		return order, true
+	}
+	return dateOrderDMY, true
+}
+
+// ParseSearchDate reads a date entered for a search, eg for SceneSearchFilter.Released, as the start of that day in
+// UTC like release dates are indexed. YYYY-MM-DD and dates with an English month name, eg 3 Apr 2024, are always
+// accepted, numeric dates like 03/04/2024 are read in the order of config.Config.Advanced.SearchDateLocale.
+func ParseSearchDate(input string) (time.Time, error) {
+	return parseSearchDate(input, config.Config.Advanced.SearchDateLocale)
+}
+
+func parseSearchDate(input string, locale string) (time.Time, error) {
+	value := strings.TrimSpace(input)
+	order, hasLocale := localeDateOrder(locale)
+
+	if m := numericDateRegex.FindStringSubmatch(value); m != nil && m[2] == m[4] {
+		parts := []string{m[1], m[3], m[5]}
+		switch {
+		// a leading year cannot be mistaken for a day, whatever the locale
+		case len(parts[0]) == 4:
+			order = dateOrderYMD
+		case !hasLocale:
+			return time.Time{}, fmt.Errorf("date %q is ambiguous without a date locale, use YYYY-MM-DD", input)
+		}
+		return numericDate(input, parts, order, locale)
+	}
+
+	normalized := strings.Join(strings.Fields(strings.ReplaceAll(value, ",", " ")), " ")
+	for _, layout := range namedMonthLayouts {
+		if t, err := time.Parse(layout, normalized); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%q is not a date, use %v", input, dateFormatHint(locale))
+}
+
+func numericDate(input string, parts []string, order dateOrder, locale string) (time.Time, error) {
+	var year, month, day string
+	switch order {
+	case dateOrderYMD:
+		year, month, day = parts[0], parts[1], parts[2]
+	case dateOrderMDY:
+		month, day, year = parts[0], parts[1], parts[2]
+	default:
+		day, month, year = parts[0], parts[1], parts[2]
+	}
+	// two digit years are left out rather than guessing the century
+	if len(year) != 4 {
+		return time.Time{}, fmt.Errorf("%q is not a date, use %v", input, dateFormatHint(locale))
+	}
+
+	y, _ := strconv.Atoi(year)
+	m, _ := strconv.Atoi(month)
+	d, _ := strconv.Atoi(day)
+	t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	// time.Date moves 31/04 to 1 May, such dates do not exist
+	if t.Year() != y || int(t.Month()) != m || t.Day() != d {
+		return time.Time{}, fmt.Errorf("%q is not a valid date, read as day %v of month %v of %v", input, d, m, y)
+	}
+	return t, nil
+}
+
+// dateFormatHint describes the dates accepted for the locale, for error messages
+func dateFormatHint(locale string) string {
+	order, ok := localeDateOrder(locale)
+	if !ok {
+		return "YYYY-MM-DD"
+	}
+	switch order {
+	case dateOrderMDY:
+		return "YYYY-MM-DD or MM/DD/YYYY"
+	case dateOrderYMD:
+		return "YYYY-MM-DD or YYYY/MM/DD"
+	default:
+		return "YYYY-MM-DD or DD/MM/YYYY"
+	}
+}
+
+// ParseSearchDateRange reads the dates entered for a date range with ParseSearchDate, both days included. An empty
+// date leaves that side of the range open.
+func ParseSearchDateRange(from, to string) (DateRange, error) {
+	r := DateRange{AfterInclusive: true, BeforeInclusive: true}
+	if strings.TrimSpace(from) != "" {
+		t, err := ParseSearchDate(from)
+		if err != nil {
+			return r, err
+		}
+		r.After = &t
+	}
+	if strings.TrimSpace(to) != "" {
+		t, err := ParseSearchDate(to)
+		if err != nil {
+			return r, err
+		}
+		r.Before = &t
+	}
+	if r.After != nil && r.Before != nil && r.Before.Before(*r.After) {
+		return r, fmt.Errorf("date range ends on %v, before it starts on %v", r.Before.Format("2006-01-02"), r.After.Format("2006-01-02"))
+	}
+	return r, nil
+}
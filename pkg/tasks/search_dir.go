@@ -0,0 +1,132 @@
+package tasks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xbapps/xbvr/pkg/common"
+	"github.com/xbapps/xbvr/pkg/config"
+	"github.com/xbapps/xbvr/pkg/models"
+)
+
+// IndexDir is the folder the search indexes are kept in, config.Config.Storage.IndexPath when set
+func IndexDir() string {
+	if config.Config.Storage.IndexPath != "" {
+		return config.Config.Storage.IndexPath
+	}
+	return common.IndexDirV2
+}
+
+// ValidateIndexDir creates dir when it does not exist and checks files can be written to it
+func ValidateIndexDir(dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".xbvr-write-test-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// MoveSearchIndex keeps the search index in dir from now on, an empty dir is the default folder.
+// The existing index is moved when dir has none, if it cannot be moved, eg to another disk, it is rebuilt in dir.
+// The config is updated but not saved.
+func MoveSearchIndex(dir string) error {
+	newDir := dir
+	if newDir == "" {
+		newDir = common.IndexDirV2
+	}
+	if err := ValidateIndexDir(newDir); err != nil {
+		return err
+	}
+
+	sceneIndexMu.Lock()
+	defer sceneIndexMu.Unlock()
+
+	oldDir := IndexDir()
+	config.Config.Storage.IndexPath = dir
+	if filepath.Clean(oldDir) == filepath.Clean(newDir) {
+		return nil
+	}
+
+	// the index files must be closed before they can be moved on Windows
+	if sceneIndex != nil {
+		sceneIndex.Bleve.Close()
+		sceneIndex = nil
+	}
+
+	oldPath := filepath.Join(oldDir, "scenes")
+	newPath := filepath.Join(newDir, "scenes")
+	if _, err := os.Stat(newPath); err == nil {
+		log.Infof("Using the search index already in %v", newDir)
+		return nil
+	}
+	if _, err := os.Stat(oldPath); err == nil {
+		err := os.Rename(oldPath, newPath)
+		if err == nil {
+			os.Rename(indexMetaPath(oldPath), indexMetaPath(newPath))
+			log.Infof("Moved the search index from %v to %v", oldDir, newDir)
+			return nil
+		}
+		log.Warnf("Could not move the search index from %v to %v, it will be rebuilt: %v", oldDir, newDir, err)
+	}
+
+	// SearchIndex opens the index once the lock is released
+	go SearchIndex()
+	return nil
+}
+
+// ClearIndex deletes the scene index so it can be rebuilt clean, the next GetSceneIndex call creates an empty one.
+// Only the index is removed from a configured folder as it may hold other files. It is refused while the index is
+// being built, and the changed scenes watermark is reset so the next changed run indexes every scene.
+func ClearIndex() error {
+	if models.CheckLock("index") {
+		return errors.New("the search index is being built, clear it once that has finished")
+	}
+	models.CreateLock("index")
+	defer models.RemoveLock("index")
+
+	if err := removeSceneIndex(); err != nil {
+		return err
+	}
+
+	db, _ := models.GetDB()
+	defer db.Close()
+	db.Where(&models.KV{Key: searchIndexWatermarkKey}).Delete(&models.KV{})
+
+	log.WithFields(logrus.Fields{"task": "scrape"}).Infof("Cleared search index")
+	return nil
+}
+
+// removeSceneIndex closes the shared scene index and deletes its files, holding the index handle so nothing reopens
+// it in between
+func removeSceneIndex() error {
+	sceneIndexMu.Lock()
+	defer sceneIndexMu.Unlock()
+
+	// the index files must be closed before they can be removed on Windows
+	if sceneIndex != nil {
+		sceneIndex.Bleve.Close()
+		sceneIndex = nil
+	}
+
+	if config.Config.Storage.IndexPath == "" {
+		if err := os.RemoveAll(common.IndexDirV2); err != nil {
+			return err
+		}
+		return os.MkdirAll(common.IndexDirV2, os.ModePerm)
+	}
+	path := sceneIndexPath()
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	if err := os.Remove(indexMetaPath(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
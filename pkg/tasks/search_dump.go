@@ -0,0 +1,204 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/blevesearch/bleve/v2/mapping"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// DumpSceneDocument returns the fields stored in the search index for a scene, to compare with the db when
+// a scene cannot be found
+func DumpSceneDocument(sceneID string) (SceneIndexed, error) {
+	idx, err := GetSceneIndex()
+	if err != nil {
+		return SceneIndexed{}, err
+	}
+	return idx.storedScene(sceneID)
+}
+
+// DumpSceneTokens returns the terms each text field of a scene was indexed as, these are what a search has to match
+func DumpSceneTokens(sceneID string) (map[string][]string, error) {
+	idx, err := GetSceneIndex()
+	if err != nil {
+		return nil, err
+	}
+	return idx.storedTokens(sceneID)
+}
+
+// DumpSearchIndex writes every document in the search index to a file, one JSON document per line
+func DumpSearchIndex(path string) (int, error) {
+	idx, err := GetSceneIndex()
+	if err != nil {
+		return 0, err
+	}
+	ids, err := idx.documentIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	count := 0
+	for _, id := range ids {
+		doc, err := idx.storedScene(id)
+		if err != nil {
+			return count, err
+		}
+		if err := enc.Encode(doc); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (i *Index) storedScene(id string) (SceneIndexed, error) {
+	var si SceneIndexed
+
+	d, err := i.Bleve.Document(id)
+	if err != nil {
+		return si, err
+	}
+	if d == nil {
+		return si, fmt.Errorf("scene %v is not in the search index", id)
+	}
+
+	d.VisitFields(func(field index.Field) {
+		switch f := field.(type) {
+		case index.TextField:
+			text := f.Text()
+			switch field.Name() {
+			case "description":
+				si.Description = text
+			case "title":
+				si.Title = text
+			case "original_title":
+				si.OriginalTitle = text
+			case "cast":
+				si.Cast = text
+			case "cast_exact":
+				si.CastExact = append(si.CastExact, text)
+			case "tags":
+				si.Tags = text
+			case "tags_exact":
+				si.TagsExact = append(si.TagsExact, text)
+			case "site":
+				si.Site = text
+			case "site_exact":
+				si.SiteExact = text
+			case "studio":
+				si.Studio = text
+			case "id":
+				si.Id = text
+			case "id_exact":
+				si.IdExact = text
+			case "path":
+				si.Path = append(si.Path, text)
+			case "cover_url":
+				si.CoverURL = text
+			}
+		case index.DateTimeField:
+			dt, _, err := f.DateTime()
+			if err != nil {
+				return
+			}
+			switch field.Name() {
+			case "released":
+				si.Released = dt
+			case "added":
+				si.Added = dt
+			}
+		case index.NumericField:
+			num, err := f.Number()
+			if err != nil {
+				return
+			}
+			switch field.Name() {
+			case "added_at":
+				si.AddedAt = int64(num)
+			case "updated_at":
+				si.UpdatedAt = int64(num)
+			case "duration":
+				si.Duration = int(num)
+			case "file_size":
+				si.FileSize = int64(num)
+			case "height":
+				height := int(num)
+				si.Height = &height
+			case "cast_count":
+				si.CastCount = int(num)
+			case "rating":
+				si.Rating = num
+			case "image_count":
+				si.ImageCount = int(num)
+			case "year":
+				year := int(num)
+				si.Year = &year
+			}
+		case index.BooleanField:
+			b, err := f.Boolean()
+			if err != nil {
+				return
+			}
+			switch field.Name() {
+			case "watched":
+				si.IsWatched = b
+			case "favourite":
+				si.Favourite = b
+			case "wishlist":
+				si.Wishlist = b
+			case "has_cast":
+				si.HasCast = b
+			case "has_tags":
+				si.HasTags = b
+			case "has_script":
+				si.HasScript = b
+			}
+		}
+	})
+	// searchable is not stored, it is built from the other text fields
+	si.Searchable = searchableText(si)
+
+	return si, nil
+}
+
+// storedTokens runs the stored text fields back through the analyzer of each field
+func (i *Index) storedTokens(id string) (map[string][]string, error) {
+	m, ok := i.Bleve.Mapping().(*mapping.IndexMappingImpl)
+	if !ok {
+		return nil, fmt.Errorf("unsupported index mapping %T", i.Bleve.Mapping())
+	}
+
+	d, err := i.Bleve.Document(id)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, fmt.Errorf("scene %v is not in the search index", id)
+	}
+
+	tokens := map[string][]string{}
+	d.VisitFields(func(field index.Field) {
+		f, ok := field.(index.TextField)
+		if !ok {
+			return
+		}
+		stream, err := m.AnalyzeText(m.AnalyzerNameForPath(field.Name()), []byte(f.Text()))
+		if err != nil {
+			return
+		}
+		for _, token := range stream {
+			tokens[field.Name()] = append(tokens[field.Name()], string(token.Term))
+		}
+	})
+
+	return tokens, nil
+}
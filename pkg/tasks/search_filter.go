@@ -0,0 +1,409 @@
+package tasks
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/xbapps/xbvr/pkg/models"
+)
+
+// SceneSearchFilter restricts a text search to scenes matching all of the set criteria, nil criteria are ignored
+type SceneSearchFilter struct {
+	MinDuration *int // minutes, inclusive
+	MaxDuration *int // minutes, inclusive
+	MinHeight   *int // pixels of the tallest video file, inclusive
+	MaxHeight   *int
+	MinFileSize *int64 // bytes summed over every file of the scene, inclusive
+	MaxFileSize *int64
+	MinCast     *int // number of distinct cast members, inclusive
+	MaxCast     *int
+	Year        *int     // release year
+	MinRating   *float64 // stars, inclusive, unrated scenes have a rating of 0
+	Released    *DateRange
+	Added       *DateRange // the day the scene was added, days are UTC
+	Watched     *bool
+	Scripted    *bool // with or without a script file
+	HasGallery  *bool // with or without gallery images
+
+	FavouriteOnly bool
+	WishlistOnly  bool
+	MissingCast   bool // only scenes without any cast
+	MissingTags   bool // only scenes without any tags
+
+	// only scenes from any of these exact site names, eg "VR Bangers", empty for every site
+	Sites []string
+
+	// scenes with any of these exact tag or site names are left out
+	ExcludeTags  []string
+	ExcludeSites []string
+
+	// only these scenes are searched, eg the results of an earlier search. An empty, non nil list matches nothing.
+	SceneIDs []string
+}
+
+// DateRange is a window on a date field, a nil bound leaves that side open
+type DateRange struct {
+	After           *time.Time
+	Before          *time.Time
+	AfterInclusive  bool
+	BeforeInclusive bool
+}
+
+func (r DateRange) query(field string) query.Query {
+	var start, end time.Time
+	if r.After != nil {
+		start = *r.After
+	}
+	if r.Before != nil {
+		end = *r.Before
+	}
+	afterInclusive := r.AfterInclusive
+	beforeInclusive := r.BeforeInclusive
+	q := bleve.NewDateRangeInclusiveQuery(start, end, &afterInclusive, &beforeInclusive)
+	q.SetField(field)
+	return q
+}
+
+func (f SceneSearchFilter) queries() []query.Query {
+	var queries []query.Query
+
+	if f.MinDuration != nil || f.MaxDuration != nil {
+		queries = append(queries, numericRangeQuery("duration", f.MinDuration, f.MaxDuration))
+	}
+	if f.MinHeight != nil || f.MaxHeight != nil {
+		queries = append(queries, numericRangeQuery("height", f.MinHeight, f.MaxHeight))
+	}
+	if f.MinFileSize != nil || f.MaxFileSize != nil {
+		queries = append(queries, numericRangeQuery("file_size", f.MinFileSize, f.MaxFileSize))
+	}
+	if f.MinCast != nil || f.MaxCast != nil {
+		queries = append(queries, numericRangeQuery("cast_count", f.MinCast, f.MaxCast))
+	}
+	if f.MinRating != nil {
+		queries = append(queries, floatRangeQuery("rating", f.MinRating, nil))
+	}
+	if f.Year != nil {
+		queries = append(queries, numericRangeQuery("year", f.Year, f.Year))
+	}
+	if f.Watched != nil {
+		queries = append(queries, boolQuery("watched", *f.Watched))
+	}
+	if f.Scripted != nil {
+		queries = append(queries, boolQuery("has_script", *f.Scripted))
+	}
+	if f.HasGallery != nil {
+		one, none := 1, 0
+		if *f.HasGallery {
+			queries = append(queries, numericRangeQuery("image_count", &one, nil))
+		} else {
+			queries = append(queries, numericRangeQuery("image_count", nil, &none))
+		}
+	}
+	if f.FavouriteOnly {
+		queries = append(queries, boolQuery("favourite", true))
+	}
+	if f.WishlistOnly {
+		queries = append(queries, boolQuery("wishlist", true))
+	}
+	if f.MissingCast {
+		queries = append(queries, boolQuery("has_cast", false))
+	}
+	if f.MissingTags {
+		queries = append(queries, boolQuery("has_tags", false))
+	}
+	if f.Released != nil && (f.Released.After != nil || f.Released.Before != nil) {
+		queries = append(queries, f.Released.query("released"))
+	}
+	if f.Added != nil && (f.Added.After != nil || f.Added.Before != nil) {
+		queries = append(queries, f.Added.query("added"))
+	}
+	if len(f.Sites) > 0 {
+		var sites []query.Query
+		for _, site := range f.Sites {
+			sites = append(sites, termQuery("site_exact", site))
+		}
+		queries = append(queries, bleve.NewDisjunctionQuery(sites...))
+	}
+	if f.SceneIDs != nil {
+		queries = append(queries, bleve.NewDocIDQuery(f.SceneIDs))
+	}
+
+	return queries
+}
+
+// exclusions matches the scenes the filter leaves out, nil when nothing is excluded
+func (f SceneSearchFilter) exclusions() query.Query {
+	var queries []query.Query
+	for _, tag := range f.ExcludeTags {
+		queries = append(queries, termQuery("tags_exact", tag))
+	}
+	for _, site := range f.ExcludeSites {
+		queries = append(queries, termQuery("site_exact", site))
+	}
+	if len(queries) == 0 {
+		return nil
+	}
+	return bleve.NewDisjunctionQuery(queries...)
+}
+
+func termQuery(field string, term string) query.Query {
+	q := bleve.NewTermQuery(term)
+	q.SetField(field)
+	return q
+}
+
+// numericRangeQuery builds an inclusive range query on an integer field, eg a duration or a size in bytes, a nil
+// bound leaves that side open
+func numericRangeQuery[T int | int64](field string, min *T, max *T) query.Query {
+	return floatRangeQuery(field, floatBound(min), floatBound(max))
+}
+
+// floatBound converts an optional integer bound for a range query, nil stays nil
+func floatBound[T int | int64](bound *T) *float64 {
+	if bound == nil {
+		return nil
+	}
+	v := float64(*bound)
+	return &v
+}
+
+// floatRangeQuery builds an inclusive range query on a numeric field, a nil bound leaves that side open
+func floatRangeQuery(field string, min *float64, max *float64) query.Query {
+	inclusive := true
+	q := bleve.NewNumericRangeInclusiveQuery(min, max, &inclusive, &inclusive)
+	q.SetField(field)
+	return q
+}
+
+func boolQuery(field string, value bool) query.Query {
+	q := bleve.NewBoolFieldQuery(value)
+	q.SetField(field)
+	return q
+}
+
+// boolean fields can't be matched through the query string, their tokens are moved into the filter instead
+var boolTokenRegex = regexp.MustCompile(`(?i)(^|\s)\+?(watched|scripted|gallery):(true|false)\b`)
+
+func extractBoolTokens(q string, filter *SceneSearchFilter) string {
+	for _, match := range boolTokenRegex.FindAllStringSubmatch(q, -1) {
+		value := strings.EqualFold(match[3], "true")
+		switch strings.ToLower(match[2]) {
+		case "watched":
+			filter.Watched = &value
+		case "scripted":
+			filter.Scripted = &value
+		case "gallery":
+			filter.HasGallery = &value
+		}
+	}
+	return strings.TrimSpace(boolTokenRegex.ReplaceAllString(q, " "))
+}
+
+// the query string would match year:2022 as text, which a numeric field never matches, so it is moved into the filter
+var yearTokenRegex = regexp.MustCompile(`(?i)(^|\s)\+?year:([0-9]{4})\b`)
+
+func extractYearToken(q string, filter *SceneSearchFilter) string {
+	for _, match := range yearTokenRegex.FindAllStringSubmatch(q, -1) {
+		if year, err := strconv.Atoi(match[2]); err == nil {
+			filter.Year = &year
+		}
+	}
+	return strings.TrimSpace(yearTokenRegex.ReplaceAllString(q, " "))
+}
+
+// ratingTokenRegex matches rating>=4 in a query, rating:>=4 is accepted too, as query string syntax would write it
+var ratingTokenRegex = regexp.MustCompile(`(?i)(^|\s)\+?rating:?>=([0-9]+(\.[0-9]+)?)\b`)
+
+func extractRatingToken(q string, filter *SceneSearchFilter) string {
+	for _, match := range ratingTokenRegex.FindAllStringSubmatch(q, -1) {
+		if rating, err := strconv.ParseFloat(match[2], 64); err == nil {
+			filter.MinRating = &rating
+		}
+	}
+	return strings.TrimSpace(ratingTokenRegex.ReplaceAllString(q, " "))
+}
+
+// withoutSites excludes the scenes of the sites from q, every search leaves out config.Config.Web.SearchExcludeSites
+func withoutSites(q query.Query, sites []string) query.Query {
+	if len(sites) == 0 {
+		return q
+	}
+	terms := make([]query.Query, 0, len(sites))
+	for _, site := range sites {
+		term := bleve.NewTermQuery(site)
+		term.SetField("site_exact")
+		terms = append(terms, term)
+	}
+	bq := bleve.NewBooleanQuery()
+	bq.AddMust(q)
+	bq.AddMustNot(terms...)
+	return bq
+}
+
+// SceneContentFilter is what one user may see, it is applied to the query of every search they run so counts, facets
+// and pages only ever include their scenes. Tags and sites are matched by their full names. A zero filter lets every
+// scene through.
+type SceneContentFilter struct {
+	AllowedTags  []string // when set, only scenes with any of these tags
+	BlockedTags  []string // scenes with any of these tags are left out, even when they also have an allowed tag
+	AllowedSites []string // when set, only scenes from any of these sites
+	BlockedSites []string
+}
+
+// restrict limits q to the scenes the filter lets through, q is returned unchanged when nothing is restricted
+func (f SceneContentFilter) restrict(q query.Query) query.Query {
+	if len(f.AllowedTags) == 0 && len(f.BlockedTags) == 0 && len(f.AllowedSites) == 0 && len(f.BlockedSites) == 0 {
+		return q
+	}
+	bq := bleve.NewBooleanQuery()
+	bq.AddMust(q)
+	if len(f.AllowedTags) > 0 {
+		bq.AddMust(anyTermQuery("tags_exact", f.AllowedTags))
+	}
+	if len(f.AllowedSites) > 0 {
+		bq.AddMust(anyTermQuery("site_exact", f.AllowedSites))
+	}
+	if len(f.BlockedTags) > 0 {
+		bq.AddMustNot(anyTermQuery("tags_exact", f.BlockedTags))
+	}
+	if len(f.BlockedSites) > 0 {
+		bq.AddMustNot(anyTermQuery("site_exact", f.BlockedSites))
+	}
+	return bq
+}
+
+// allows reports whether the filter lets the scene of a stored document through, as restrict does for a query
+func (f SceneContentFilter) allows(si SceneIndexed) bool {
+	hasAny := func(values []string, names []string) bool {
+		for _, name := range names {
+			if slices.Contains(values, name) {
+				return true
+			}
+		}
+		return false
+	}
+	site := []string{si.SiteExact}
+	if len(f.AllowedTags) > 0 && !hasAny(si.TagsExact, f.AllowedTags) {
+		return false
+	}
+	if len(f.AllowedSites) > 0 && !hasAny(site, f.AllowedSites) {
+		return false
+	}
+	return !hasAny(si.TagsExact, f.BlockedTags) && !hasAny(site, f.BlockedSites)
+}
+
+func anyTermQuery(field string, terms []string) query.Query {
+	queries := make([]query.Query, 0, len(terms))
+	for _, term := range terms {
+		queries = append(queries, termQuery(field, term))
+	}
+	return bleve.NewDisjunctionQuery(queries...)
+}
+
+// filteredQuery combines the text query with the filter, without any filters it is the plain text search
+func filteredQuery(q string, mode SearchMode, filter SceneSearchFilter) query.Query {
+	q = extractBoolTokens(q, &filter)
+	q = extractYearToken(q, &filter)
+	q = extractRatingToken(q, &filter)
+
+	var must query.Query
+	filters := filter.queries()
+	switch {
+	case len(filters) == 0:
+		must = textQuery(q, mode)
+	case q == "":
+		must = bleve.NewConjunctionQuery(filters...)
+	default:
+		must = bleve.NewConjunctionQuery(append([]query.Query{textQuery(q, mode)}, filters...)...)
+	}
+
+	exclusions := filter.exclusions()
+	if exclusions == nil {
+		return must
+	}
+	bq := bleve.NewBooleanQuery()
+	bq.AddMust(must)
+	bq.AddMustNot(exclusions)
+	return bq
+}
+
+// SearchScenesWithFilter runs the query string search restricted by the filter
+func SearchScenesWithFilter(q string, filter SceneSearchFilter) ([]models.Scene, error) {
+	result, err := searchScenes(filteredQuery(q, SearchModeQueryString, filter), SceneSearchOptions{})
+	return result.Scenes, err
+}
+
+// SearchScenesBySites runs the query string search over the scenes of any of the sites, matched by their full name
+// so names with spaces work. An empty q returns every scene of those sites.
+func SearchScenesBySites(q string, sites []string) ([]models.Scene, error) {
+	return SearchScenesWithFilter(q, SceneSearchFilter{Sites: sites})
+}
+
+// SearchWithinIDs runs the query string search only over the scenes with the given ids, so the results of an
+// earlier search can be narrowed without searching the whole index again. An empty q returns all of those scenes.
+func SearchWithinIDs(q string, ids []string) ([]models.Scene, error) {
+	if ids == nil {
+		ids = []string{}
+	}
+	return SearchScenesWithFilter(q, SceneSearchFilter{SceneIDs: ids})
+}
+
+// SearchScenesFiltered runs the query string search restricted to scenes with a duration between minDur and maxDur minutes,
+// leaving out scenes with any of the excludeTags or from any of the excludeSites. missingCast and missingTags only
+// return scenes without any cast or tags, to find scenes needing attention. favouriteOnly searches within the
+// favourite scenes.
+func SearchScenesFiltered(q string, minDur, maxDur *int, excludeTags []string, excludeSites []string, missingCast, missingTags, favouriteOnly bool) ([]models.Scene, error) {
+	return SearchScenesWithFilter(q, SceneSearchFilter{
+		MinDuration:   minDur,
+		MaxDuration:   maxDur,
+		ExcludeTags:   excludeTags,
+		ExcludeSites:  excludeSites,
+		MissingCast:   missingCast,
+		MissingTags:   missingTags,
+		FavouriteOnly: favouriteOnly,
+	})
+}
+
+// SearchScenesReleased runs the query string search restricted to scenes released within the date range
+func SearchScenesReleased(q string, released DateRange) ([]models.Scene, error) {
+	return SearchScenesWithFilter(q, SceneSearchFilter{Released: &released})
+}
+
+// SearchRecent runs the query string search restricted to scenes added from days ago until now, all of that first
+// day included, eg 7 for what was added this week. An empty q returns every recently added scene.
+func SearchRecent(days int, q string) ([]models.Scene, error) {
+	added := addedWithin(days, time.Now())
+	return SearchScenesWithFilter(q, SceneSearchFilter{Added: &added})
+}
+
+// addedWithin is the range of days ending at now, added is indexed as the start of its day so the first day has to be
+// included from its start
+func addedWithin(days int, now time.Time) DateRange {
+	start := now.UTC().AddDate(0, 0, -days).Truncate(24 * time.Hour)
+	end := now.UTC()
+	return DateRange{After: &start, Before: &end, AfterInclusive: true, BeforeInclusive: true}
+}
+
+// SearchScenesByHeight runs the query string search restricted to scenes with a video file between minHeight and maxHeight pixels tall
+func SearchScenesByHeight(q string, minHeight, maxHeight *int) ([]models.Scene, error) {
+	return SearchScenesWithFilter(q, SceneSearchFilter{MinHeight: minHeight, MaxHeight: maxHeight})
+}
+
+// SearchScenesByFileSize runs the query string search restricted to scenes whose files add up to between minSize and
+// maxSize bytes, largest first, eg to find the scenes taking the most space
+func SearchScenesByFileSize(q string, minSize, maxSize *int64) ([]models.Scene, error) {
+	filter := SceneSearchFilter{MinFileSize: minSize, MaxFileSize: maxSize}
+	result, err := searchScenes(filteredQuery(q, SearchModeQueryString, filter), SceneSearchOptions{SortBy: []string{"largest"}})
+	return result.Scenes, err
+}
+
+// SearchScenesByCastCount runs the query string search restricted to scenes with between minCast and maxCast cast members,
+// eg 1 and 1 for solo scenes or 3 and nil for group scenes
+func SearchScenesByCastCount(q string, minCast, maxCast *int) ([]models.Scene, error) {
+	return SearchScenesWithFilter(q, SceneSearchFilter{MinCast: minCast, MaxCast: maxCast})
+}
@@ -0,0 +1,310 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/index/scorch"
+	"github.com/blevesearch/bleve/v2/index/scorch/mergeplan"
+	"github.com/sirupsen/logrus"
+	"github.com/xbapps/xbvr/pkg/common"
+	"github.com/xbapps/xbvr/pkg/models"
+)
+
+type SearchIndexStats struct {
+	Exists          bool   `json:"exists"`
+	DocumentCount   uint64 `json:"documentCount"`
+	SizeOnDisk      int64  `json:"sizeOnDisk"`
+	SceneCount      int    `json:"sceneCount"`
+	RebuildRequired bool   `json:"rebuildRequired"` // the index was built with an older mapping or different analyzers than configured
+}
+
+// IndexStats compares the scene index with the db, a missing index is reported rather than created
+func IndexStats() (SearchIndexStats, error) {
+	var stats SearchIndexStats
+
+	db, _ := models.GetDB()
+	defer db.Close()
+	if err := db.Model(&models.Scene{}).Count(&stats.SceneCount).Error; err != nil {
+		return stats, err
+	}
+
+	if _, err := os.Stat(sceneIndexPath()); err != nil {
+		if os.IsNotExist(err) {
+			return stats, nil
+		}
+		return stats, err
+	}
+	stats.Exists = true
+
+	idx, err := GetSceneIndex()
+	if err != nil {
+		return stats, err
+	}
+	if stats.DocumentCount, err = idx.Bleve.DocCount(); err != nil {
+		return stats, err
+	}
+	stats.SizeOnDisk, _ = common.DirSize(sceneIndexPath())
+	stats.RebuildRequired = idx.MappingOutdated() || idx.AnalyzersOutdated()
+
+	return stats, nil
+}
+
+// documentIDs lists the ids of every document in the index
+func (i *Index) documentIDs() ([]string, error) {
+	var ids []string
+
+	req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 1000, 0, false)
+	req.SortBy([]string{"_id"})
+	for {
+		res, err := i.Bleve.Search(req)
+		if err != nil {
+			return nil, err
+		}
+		for _, hit := range res.Hits {
+			ids = append(ids, hit.ID)
+		}
+		if len(res.Hits) < req.Size {
+			break
+		}
+		req.SearchAfter = []string{res.Hits[len(res.Hits)-1].ID}
+	}
+
+	return ids, nil
+}
+
+// PruneDeletedScenes removes documents for scenes that no longer exist in the db, a dry run only counts them
+func PruneDeletedScenes(dryRun bool) (int, error) {
+	tlog := log.WithFields(logrus.Fields{"task": "scrape"})
+
+	idx, err := GetSceneIndex()
+	if err != nil {
+		return 0, err
+	}
+	removed, err := idx.pruneDeletedScenes(dryRun, existingSceneIDs)
+	if err != nil {
+		return removed, err
+	}
+
+	if dryRun {
+		tlog.Infof("%v deleted scenes would be removed from search index", removed)
+	} else {
+		tlog.Infof("Removed %v deleted scenes from search index", removed)
+	}
+	return removed, nil
+}
+
+// existingSceneIDs returns which of the scene ids are in the db
+func existingSceneIDs(ids []string) ([]string, error) {
+	db, _ := models.GetDB()
+	defer db.Close()
+
+	var existing []string
+	err := db.Model(&models.Scene{}).Where("scene_id in (?)", ids).Pluck("scene_id", &existing).Error
+	return existing, err
+}
+
+func (i *Index) pruneDeletedScenes(dryRun bool, exists func(ids []string) ([]string, error)) (int, error) {
+	ids, err := i.documentIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for start := 0; start < len(ids); start += 500 {
+		end := start + 500
+		if end > len(ids) {
+			end = len(ids)
+		}
+		page := ids[start:end]
+
+		existing, err := exists(page)
+		if err != nil {
+			return removed, err
+		}
+		found := make(map[string]bool, len(existing))
+		for _, id := range existing {
+			found[id] = true
+		}
+
+		batch := i.Bleve.NewBatch()
+		for _, id := range page {
+			if !found[id] {
+				batch.Delete(id)
+			}
+		}
+		if dryRun {
+			removed += batch.Size()
+			continue
+		}
+		if batch.Size() > 0 {
+			if err := i.Batch(batch); err != nil {
+				return removed, err
+			}
+			removed += batch.Size()
+		}
+	}
+	return removed, nil
+}
+
+// SearchIndexSummary is what SearchIndex would change in the index
+type SearchIndexSummary struct {
+	ToAdd    int  `json:"toAdd"`    // scenes without a document
+	ToUpdate int  `json:"toUpdate"` // scenes saved since they were indexed, or missing fields added since
+	ToPrune  int  `json:"toPrune"`  // documents of deleted scenes, only removed when pruning is enabled
+	Rebuild  bool `json:"rebuild"`  // the index mapping is outdated, every scene is indexed again
+}
+
+// SearchIndexDryRun walks the scenes as SearchIndex does and counts what it would change, without changing the index
+func SearchIndexDryRun() (SearchIndexSummary, error) {
+	var summary SearchIndexSummary
+
+	idx, err := GetSceneIndex()
+	if err != nil {
+		return summary, err
+	}
+
+	db, _ := models.GetDB()
+	defer db.Close()
+
+	summary.Rebuild = idx.MappingOutdated()
+	for offset := 0; ; offset += 1000 {
+		var scenes []models.Scene
+		if err := db.Model(&models.Scene{}).Select("scene_id, updated_at").Order("id").Offset(offset).Limit(1000).Find(&scenes).Error; err != nil {
+			return summary, err
+		}
+		if len(scenes) == 0 {
+			break
+		}
+		for _, scene := range scenes {
+			switch {
+			case summary.Rebuild || !idx.Exist(scene.SceneID):
+				summary.ToAdd++
+			case !idx.Current(scene) || !idx.HasFields(scene.SceneID, backfillFields...):
+				summary.ToUpdate++
+			}
+		}
+	}
+
+	if summary.ToPrune, err = PruneDeletedScenes(true); err != nil {
+		return summary, err
+	}
+
+	log.WithFields(logrus.Fields{"task": "scrape"}).Infof("Search index dry run: %v scenes to add, %v to update, %v to prune", summary.ToAdd, summary.ToUpdate, summary.ToPrune)
+	return summary, nil
+}
+
+// SearchIndexHealth is the result of VerifyIndex, an unhealthy index should be rebuilt
+type SearchIndexHealth struct {
+	Healthy       bool   `json:"healthy"`
+	DocumentCount uint64 `json:"documentCount"`
+	SceneCount    int    `json:"sceneCount"`
+	Error         string `json:"error,omitempty"` // what failed, when the index is not healthy
+}
+
+// VerifyIndex checks the scene index can be opened, counted and searched, and that a document found by a search
+// can be loaded back, which fails on damaged segments that still open
+func VerifyIndex() SearchIndexHealth {
+	var health SearchIndexHealth
+
+	db, _ := models.GetDB()
+	db.Model(&models.Scene{}).Count(&health.SceneCount)
+	db.Close()
+
+	idx, err := GetSceneIndex()
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.DocumentCount, err = idx.verify()
+	if err != nil {
+		health.Error = err.Error()
+	} else {
+		health.Healthy = true
+	}
+
+	log.WithFields(logrus.Fields{"task": "scrape"}).Infof("Search index verified, healthy: %v, %v documents for %v scenes", health.Healthy, health.DocumentCount, health.SceneCount)
+	return health
+}
+
+func (i *Index) verify() (uint64, error) {
+	count, err := i.Bleve.DocCount()
+	if err != nil {
+		return 0, fmt.Errorf("documents cannot be counted: %w", err)
+	}
+
+	req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 1, 0, false)
+	res, err := i.Bleve.Search(req)
+	if err != nil {
+		return count, fmt.Errorf("index cannot be searched: %w", err)
+	}
+	if count > 0 && len(res.Hits) == 0 {
+		return count, fmt.Errorf("a search found none of the %v documents", count)
+	}
+	for _, hit := range res.Hits {
+		if _, err := i.storedScene(hit.ID); err != nil {
+			return count, fmt.Errorf("document %v cannot be loaded: %w", hit.ID, err)
+		}
+	}
+	return count, nil
+}
+
+// SearchIndexCompaction is the size of the scene index before and after CompactIndex
+type SearchIndexCompaction struct {
+	SizeBefore int64 `json:"sizeBefore"`
+	SizeAfter  int64 `json:"sizeAfter"`
+}
+
+// CompactIndex merges the segments of the scene index into one, dropping deleted and replaced documents that scorch
+// would otherwise keep until its background merges get to them. It is refused while the index is being built.
+func CompactIndex() (SearchIndexCompaction, error) {
+	var compaction SearchIndexCompaction
+
+	if models.CheckLock("index") {
+		return compaction, errors.New("the search index is being built, compact it once that has finished")
+	}
+	idx, err := GetSceneIndex()
+	if err != nil {
+		return compaction, err
+	}
+
+	compaction.SizeBefore, _ = common.DirSize(sceneIndexPath())
+	if err := idx.compact(); err != nil {
+		return compaction, err
+	}
+	compaction.SizeAfter = settledDirSize(sceneIndexPath(), 10*time.Second)
+
+	log.WithFields(logrus.Fields{"task": "scrape"}).Infof("Compacted search index from %v to %v bytes", compaction.SizeBefore, compaction.SizeAfter)
+	return compaction, nil
+}
+
+// settledDirSize waits for the size of a folder to stop changing, scorch removes the files of merged segments
+// in the background after the merge has returned
+func settledDirSize(path string, timeout time.Duration) int64 {
+	size, _ := common.DirSize(path)
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); {
+		time.Sleep(250 * time.Millisecond)
+		next, _ := common.DirSize(path)
+		if next == size {
+			break
+		}
+		size = next
+	}
+	return size
+}
+
+func (i *Index) compact() error {
+	advanced, err := i.Bleve.Advanced()
+	if err != nil {
+		return err
+	}
+	s, ok := advanced.(*scorch.Scorch)
+	if !ok {
+		return fmt.Errorf("search index type %T cannot be compacted", advanced)
+	}
+	return s.ForceMerge(context.Background(), &mergeplan.SingleSegmentMergePlanOptions)
+}
@@ -0,0 +1,36 @@
+package tasks
+
+import (
+	"time"
+
+	"github.com/xbapps/xbvr/pkg/common"
+)
+
+// indexProgress publishes the progress of an indexing run over the websocket, so the UI can show it as it happens.
+// Each update is a search.index.progress event and the end of the run a search.index.done event with its duration.
+type indexProgress struct {
+	task  string // rebuild, update or changed
+	start time.Time
+}
+
+func newIndexProgress(task string) *indexProgress {
+	return &indexProgress{task: task, start: time.Now()}
+}
+
+func (p *indexProgress) update(current int, total int, message string) {
+	common.PublishWS("search.index.progress", map[string]interface{}{
+		"task":    p.task,
+		"current": current,
+		"total":   total,
+		"message": message,
+	})
+}
+
+func (p *indexProgress) done(total int, message string) {
+	common.PublishWS("search.index.done", map[string]interface{}{
+		"task":     p.task,
+		"total":    total,
+		"duration": time.Since(p.start).Milliseconds(),
+		"message":  message,
+	})
+}
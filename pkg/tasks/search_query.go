@@ -0,0 +1,462 @@
+package tasks
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/xbapps/xbvr/pkg/config"
+	"github.com/xbapps/xbvr/pkg/models"
+)
+
+// SearchMode selects how the text of a search is interpreted
+type SearchMode string
+
+const (
+	// SearchModeQueryString parses the text as bleve query string syntax, eg +title:word cast:"full name" -tags:word.
+	// Every word without a + or - has to match, each in any field, so riley pov finds Riley's POV scenes,
+	// unless config.Config.Web.SearchMatchAnyWord is set. This is the default and what the search box in the UI uses.
+	SearchModeQueryString SearchMode = ""
+	// SearchModePhrase matches the text as a single phrase in the title or description
+	SearchModePhrase SearchMode = "phrase"
+	// SearchModeMatch matches the words in any field, allowing for a typo in each word
+	SearchModeMatch SearchMode = "match"
+	// SearchModePrefix matches the start of words, eg cast:ril finds Riley, words without a field match the title
+	SearchModePrefix SearchMode = "prefix"
+)
+
+// textQuery builds the query for the text of a search in the given mode
+func textQuery(q string, mode SearchMode) query.Query {
+	return withSiteBoosts(modeQuery(q, mode), config.Config.Advanced.SearchSiteBoosts)
+}
+
+func modeQuery(q string, mode SearchMode) query.Query {
+	switch mode {
+	case SearchModePhrase:
+		title := bleve.NewMatchPhraseQuery(q)
+		title.SetField("title")
+		description := bleve.NewMatchPhraseQuery(q)
+		description.SetField("description")
+		return bleve.NewDisjunctionQuery(title, description)
+	case SearchModeMatch:
+		match := bleve.NewMatchQuery(q)
+		match.SetFuzziness(1)
+		return match
+	case SearchModePrefix:
+		return prefixSearchQuery(q)
+	default:
+		qs := q
+		if !config.Config.Web.SearchMatchAnyWord {
+			qs = requireAllTerms(q)
+		}
+		return withFieldBoosts(bleve.NewQueryStringQuery(qs), q, config.Config.Advanced.SearchFieldBoosts)
+	}
+}
+
+// requireAllTerms prefixes every term of a query string search with + unless it already has a + or -, bleve
+// otherwise only requires one of them to match. Words without a field match the searchable field, which holds all
+// of the text fields, so each word can match in a different field.
+func requireAllTerms(q string) string {
+	terms := queryStringTerms(q)
+	for i, term := range terms {
+		if !strings.HasPrefix(term, "+") && !strings.HasPrefix(term, "-") {
+			terms[i] = "+" + term
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// unfieldedWords returns the words of a query string search that are not limited to a field or excluded,
+// these match the combined searchable field so every field counts the same unless they are boosted
+func unfieldedWords(q string) string {
+	var words []string
+	for _, word := range queryStringTerms(q) {
+		if strings.HasPrefix(word, "-") || strings.Contains(word, ":") {
+			continue
+		}
+		if word = strings.Trim(word, `+"()*?~^`); word != "" {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// queryStringTerms splits a query string search on spaces outside quotes, so a quoted phrase stays one term
+func queryStringTerms(q string) []string {
+	var terms []string
+	var term strings.Builder
+	quoted := false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			term.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+	return terms
+}
+
+// withFieldBoosts adds to the score of scenes where the unfielded words of q match the title, cast, tags or
+// description by the boost of that field, without changing which scenes match
+func withFieldBoosts(q query.Query, text string, boosts config.SearchFieldBoosts) query.Query {
+	words := unfieldedWords(text)
+	if words == "" {
+		return q
+	}
+	boosted := bleve.NewBooleanQuery()
+	boosted.AddMust(q)
+	for _, f := range []struct {
+		name  string
+		boost float64
+	}{
+		{"title", boosts.Title},
+		{"cast", boosts.Cast},
+		{"tags", boosts.Tags},
+		{"description", boosts.Description},
+	} {
+		if f.boost <= 0 {
+			continue
+		}
+		match := bleve.NewMatchQuery(words)
+		match.SetField(f.name)
+		match.SetBoost(f.boost)
+		boosted.AddShould(match)
+	}
+	if boosted.Should == nil {
+		return q
+	}
+	boosted.SetMinShould(0)
+	return boosted
+}
+
+// withSiteBoosts raises the score of scenes from the sites given a boost above 1, each boost is a term query on the
+// site, merged into the query by a disjunction so it only ranks the scenes q matches. A boost adds to the score
+// rather than scaling it, so boosts of 1 or less leave the ranking as it is.
+func withSiteBoosts(q query.Query, boosts map[string]float64) query.Query {
+	var sites []string
+	for site, boost := range boosts {
+		if boost > 1 {
+			sites = append(sites, site)
+		}
+	}
+	if len(sites) == 0 {
+		return q
+	}
+	// the order of the clauses doesn't change the score, sorting keeps the query the same between searches
+	sort.Strings(sites)
+
+	var terms []query.Query
+	for _, site := range sites {
+		term := bleve.NewTermQuery(site)
+		term.SetField("site_exact")
+		term.SetBoost(boosts[site] - 1)
+		terms = append(terms, term)
+	}
+	boosted := bleve.NewBooleanQuery()
+	boosted.AddMust(q)
+	boosted.AddShould(bleve.NewDisjunctionQuery(terms...))
+	boosted.SetMinShould(0)
+	return boosted
+}
+
+// minPrefixLength stops a one letter prefix expanding to most of the terms in a field
+const minPrefixLength = 2
+
+// prefixFields are the fields a prefix can be searched in, they are all lowercased by their analyzer
+var prefixFields = map[string]bool{"title": true, "cast": true, "tags": true, "studio": true, "description": true}
+
+// prefixQuery matches terms in the field starting with prefix, nil if the prefix is too short or the field
+// cannot be searched this way.
+// A prefix only has to walk the terms that share it, unlike a leading wildcard in the query string syntax
+// (eg cast:*ley) which has to test every term in the field and gets slower as the library grows.
+func prefixQuery(field string, prefix string) query.Query {
+	prefix = strings.ToLower(strings.TrimRight(prefix, "*"))
+	if len([]rune(prefix)) < minPrefixLength || !prefixFields[field] {
+		return nil
+	}
+	q := bleve.NewPrefixQuery(prefix)
+	q.SetField(field)
+	return q
+}
+
+// prefixSearchQuery requires every word of q to be a prefix match, words are field:prefix or just a prefix of the title
+func prefixSearchQuery(q string) query.Query {
+	var prefixes []query.Query
+	for _, word := range strings.Fields(q) {
+		field := "title"
+		if f, p, ok := strings.Cut(word, ":"); ok {
+			field, word = strings.ToLower(f), p
+		}
+		if pq := prefixQuery(field, word); pq != nil {
+			prefixes = append(prefixes, pq)
+		}
+	}
+	if len(prefixes) == 0 {
+		return bleve.NewMatchNoneQuery()
+	}
+	return bleve.NewConjunctionQuery(prefixes...)
+}
+
+const (
+	defaultSearchFuzziness = 1
+	maxSearchFuzziness     = 2 // bleve rejects anything larger
+	minFuzzyWordLength     = 5 // shorter words are matched exactly, a typo allowance on them matches almost anything
+)
+
+// tolerantQuery requires every word to match the title or cast, allowing up to fuzziness edits in the longer words
+func tolerantQuery(q string, fuzziness int) query.Query {
+	if fuzziness < 0 {
+		fuzziness = defaultSearchFuzziness
+	}
+	if fuzziness > maxSearchFuzziness {
+		fuzziness = maxSearchFuzziness
+	}
+
+	var words []query.Query
+	for _, word := range strings.Fields(q) {
+		wordFuzziness := fuzziness
+		if len([]rune(word)) < minFuzzyWordLength {
+			wordFuzziness = 0
+		}
+
+		var fields []query.Query
+		for _, field := range []string{"title", "cast"} {
+			match := bleve.NewMatchQuery(word)
+			match.SetField(field)
+			match.SetFuzziness(wordFuzziness)
+			fields = append(fields, match)
+		}
+		words = append(words, bleve.NewDisjunctionQuery(fields...))
+	}
+	if len(words) == 0 {
+		return bleve.NewMatchNoneQuery()
+	}
+	return bleve.NewConjunctionQuery(words...)
+}
+
+// castQuery matches a quoted name exactly against the full cast names, otherwise the words match anywhere in the cast
+func castQuery(name string) query.Query {
+	name = strings.TrimSpace(name)
+	if len(name) > 1 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+		return castExactQuery(name)
+	}
+	match := bleve.NewMatchQuery(name)
+	match.SetField("cast")
+	return match
+}
+
+// castExactQuery matches one full cast name, ignoring case and any quotes around it
+func castExactQuery(name string) query.Query {
+	exact := bleve.NewTermQuery(strings.ToLower(strings.TrimSpace(strings.Trim(strings.TrimSpace(name), `"`))))
+	exact.SetField("cast_exact")
+	return exact
+}
+
+// castNamesQuery matches scenes with all of the full cast names when matchAll is set, otherwise any of them
+func castNamesQuery(names []string, matchAll bool) query.Query {
+	bq := bleve.NewBooleanQuery()
+	for _, name := range names {
+		if strings.Trim(strings.TrimSpace(name), `"`) == "" {
+			continue
+		}
+		if matchAll {
+			bq.AddMust(castExactQuery(name))
+		} else {
+			bq.AddShould(castExactQuery(name))
+		}
+	}
+	if bq.Must == nil && bq.Should == nil {
+		return bleve.NewMatchNoneQuery()
+	}
+	return bq
+}
+
+// TagOperator joins the tags of a TagGroup
+type TagOperator string
+
+const (
+	TagOperatorAnd TagOperator = "and" // scenes with every tag of the group
+	TagOperatorOr  TagOperator = "or"  // scenes with any tag of the group
+)
+
+// TagGroup is a set of tags joined by one operator, eg pov or solo. Groups are combined with and, so
+// (pov or solo) and blonde is a group of pov and solo with TagOperatorOr followed by a group of blonde.
+type TagGroup struct {
+	Tags     []string    `json:"tags"`
+	Operator TagOperator `json:"operator"` // and when empty
+}
+
+// tagGroupsQuery matches scenes matching every group, each tag is matched as a phrase in the tags field so tags of
+// several words work. Groups without any tags are ignored, a search without any matches nothing.
+func tagGroupsQuery(groups []TagGroup) query.Query {
+	all := bleve.NewBooleanQuery()
+	for _, group := range groups {
+		bq := bleve.NewBooleanQuery()
+		for _, tag := range group.Tags {
+			if strings.TrimSpace(tag) == "" {
+				continue
+			}
+			q := bleve.NewMatchPhraseQuery(tag)
+			q.SetField("tags")
+			if strings.EqualFold(string(group.Operator), string(TagOperatorOr)) {
+				bq.AddShould(q)
+			} else {
+				bq.AddMust(q)
+			}
+		}
+		if bq.Must != nil || bq.Should != nil {
+			all.AddMust(bq)
+		}
+	}
+	if all.Must == nil {
+		return bleve.NewMatchNoneQuery()
+	}
+	return all
+}
+
+// releaseCodePattern finds release codes like PXVR-258, PXVR 00258 or PXVR258 in a cleaned filename
+var releaseCodePattern = regexp.MustCompile(`\b([a-zA-Z]{2,6})[- ]?([0-9]{2,5})\b`)
+
+// idPrefixQuery matches scene ids starting with prefix, an empty prefix would match every scene and matches none
+func idPrefixQuery(prefix string) query.Query {
+	if prefix == "" {
+		return bleve.NewMatchNoneQuery()
+	}
+	q := bleve.NewPrefixQuery(prefix)
+	q.SetField("id_exact")
+	return q
+}
+
+// sceneIDPattern matches queries that could be a whole scene id, eg czechvr-123 or vrbangers-beach-day
+var sceneIDPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9_.]+)+$`)
+
+// exactScene returns the stored document of the scene a query names by its whole id, ids are looked up as typed and
+// lowercased. Queries that only look like an id, eg beach-day, are not found.
+func (i *Index) exactScene(q string) (SceneIndexed, bool) {
+	q = strings.TrimSpace(q)
+	if !sceneIDPattern.MatchString(strings.ToLower(q)) {
+		return SceneIndexed{}, false
+	}
+	for _, id := range []string{q, strings.ToLower(q)} {
+		// an error is a scene that is not indexed, or an index the text search reports the error of
+		if si, err := i.storedScene(id); err == nil {
+			return si, true
+		}
+	}
+	return SceneIndexed{}, false
+}
+
+// exactSceneVisible applies the options restricting a search to the stored document of a scene found by its id,
+// as they are applied to the query of a text search
+func exactSceneVisible(si SceneIndexed, opts SceneSearchOptions) bool {
+	if !opts.IncludeExcludedSites && slices.Contains(config.Config.Web.SearchExcludeSites, si.SiteExact) {
+		return false
+	}
+	if opts.ContentFilter != nil && !opts.ContentFilter.allows(si) {
+		return false
+	}
+	if (opts.FavouriteOnly && !si.Favourite) || (opts.WishlistOnly && !si.Wishlist) {
+		return false
+	}
+	return true
+}
+
+// exactSceneResult returns the scene q names by its whole id without running a search, false when there is no such
+// scene or the options leave it out. Facets are not counted for it.
+func (i *Index) exactSceneResult(q string, opts SceneSearchOptions) (SceneSearchResult, bool) {
+	si, ok := i.exactScene(q)
+	if !ok || !exactSceneVisible(si, opts) {
+		return SceneSearchResult{}, false
+	}
+	var scene models.Scene
+	if err := scene.GetIfExist(si.IdExact); err != nil {
+		return SceneSearchResult{}, false
+	}
+
+	result := SceneSearchResult{Scenes: []models.Scene{scene}, Total: 1, Rebuilding: SceneIndexRebuilding()}
+	if opts.Offset > 0 {
+		result.Scenes = []models.Scene{}
+	}
+	if opts.TotalDuration {
+		result.TotalDuration = scene.Duration
+	}
+	return result, true
+}
+
+const releaseCodeBoost = 5
+
+// filenameQuery matches the words of a cleaned filename anywhere in the scene, scenes where a release code
+// from the filename appears in the scene id or title are boosted well above plain word matches
+func filenameQuery(clean string) query.Query {
+	words := bleve.NewMatchQuery(clean)
+	queries := []query.Query{words}
+
+	seen := map[string]bool{}
+	for _, match := range releaseCodePattern.FindAllStringSubmatch(clean, -1) {
+		prefix := strings.ToLower(match[1])
+		num, err := strconv.Atoi(match[2])
+		if err != nil {
+			continue
+		}
+		for _, code := range []string{fmt.Sprintf("%v %v", prefix, num), fmt.Sprintf("%v %05d", prefix, num)} {
+			if seen[code] {
+				continue
+			}
+			seen[code] = true
+			for _, field := range []string{"id", "title"} {
+				phrase := bleve.NewMatchPhraseQuery(code)
+				phrase.SetField(field)
+				phrase.SetBoost(releaseCodeBoost)
+				queries = append(queries, phrase)
+			}
+		}
+	}
+	return bleve.NewDisjunctionQuery(queries...)
+}
+
+// recencyWindows are how recently a scene must be released to get a share of the recency boost,
+// a scene in the first window also matches the longer ones
+var recencyWindows = []struct {
+	age   time.Duration
+	share float64
+}{
+	{90 * 24 * time.Hour, 0.5},
+	{365 * 24 * time.Hour, 0.3},
+	{3 * 365 * 24 * time.Hour, 0.2},
+}
+
+// withRecencyBoost adds to the score of newer scenes without changing which scenes match,
+// a weight of 1 adds about as much as a good text match to a scene released in the last 90 days
+func withRecencyBoost(q query.Query, weight float64, now time.Time) query.Query {
+	if weight <= 0 {
+		return q
+	}
+	boosted := bleve.NewBooleanQuery()
+	boosted.AddMust(q)
+	for _, w := range recencyWindows {
+		after := now.Add(-w.age)
+		recent := bleve.NewDateRangeQuery(after, time.Time{})
+		recent.SetField("released")
+		recent.SetBoost(weight * w.share)
+		boosted.AddShould(recent)
+	}
+	boosted.SetMinShould(0)
+	return boosted
+}
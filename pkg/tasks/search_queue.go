@@ -0,0 +1,175 @@
+package tasks
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xbapps/xbvr/pkg/models"
+)
+
+// Scenes saved by a scrape are queued here and written to the search index by a single background indexer,
+// so they are searchable while the scrape is still running. The indexer writes as soon as the queue is empty,
+// or in batches of the configured search index batch size while scenes are arriving faster than it can write.
+var (
+	sceneIndexQueue      = make(chan string, 1000)
+	sceneIndexFlush      = make(chan chan struct{})
+	sceneIndexQueueStart sync.Once
+)
+
+// QueueSceneIndex queues scenes to be reindexed from the db in the background
+func QueueSceneIndex(sceneIDs ...string) {
+	sceneIndexQueueStart.Do(func() { go sceneIndexer() })
+	for _, id := range sceneIDs {
+		sceneIndexQueue <- id
+	}
+}
+
+// RefreshSceneStatus updates the file status of a scene and queues it to be reindexed when a script file was
+// matched or removed or the size of its files changed, so script and size filters stay current. UpdateStatus already
+// sums the file sizes, comparing its total avoids reading the search index for every scene of a refresh.
+func RefreshSceneStatus(scene *models.Scene) {
+	scripted := scene.IsScripted
+	size := scene.TotalFileSize
+	scene.UpdateStatus()
+	if scene.IsScripted != scripted || scene.TotalFileSize != size {
+		QueueSceneIndex(scene.SceneID)
+	}
+}
+
+// FlushIndexQueue waits until every scene queued before the call has been written to the index
+func FlushIndexQueue() {
+	sceneIndexQueueStart.Do(func() { go sceneIndexer() })
+	done := make(chan struct{})
+	sceneIndexFlush <- done
+	<-done
+}
+
+func sceneIndexer() {
+	var pending []string
+	queued := map[string]bool{}
+
+	add := func(id string) {
+		if !queued[id] {
+			queued[id] = true
+			pending = append(pending, id)
+		}
+	}
+	write := func() {
+		if len(pending) > 0 {
+			writeQueuedScenes(pending)
+		}
+		pending = nil
+		queued = map[string]bool{}
+	}
+
+	for {
+		select {
+		case id := <-sceneIndexQueue:
+			add(id)
+			if len(pending) >= indexBatchSize() || len(sceneIndexQueue) == 0 {
+				write()
+			}
+		case done := <-sceneIndexFlush:
+			// anything queued before the flush is already in the channel buffer
+			for len(sceneIndexQueue) > 0 {
+				add(<-sceneIndexQueue)
+			}
+			write()
+			close(done)
+		}
+	}
+}
+
+func writeQueuedScenes(sceneIDs []string) {
+	idx, err := GetSceneIndex()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	batch := idx.Bleve.NewBatch()
+	for _, id := range sceneIDs {
+		// scenes are read back from the db, as we don't want to index them if they aren't in there
+		var scene models.Scene
+		if err := scene.GetIfExist(id); err != nil {
+			continue
+		}
+		if err := idx.BatchScene(batch, scene); err != nil {
+			log.Error(err)
+		}
+	}
+	if err := idx.Batch(batch); err != nil {
+		log.Error(err)
+	}
+}
+
+// reindexDelay is how long edits are collected before they are written to the index together
+const reindexDelay = 2 * time.Second
+
+// sceneReindexer coalesces the reindexes requested by edits, see QueueReindex
+var sceneReindexer = newReindexer(reindexDelay, writeQueuedScenes)
+
+// QueueReindex reindexes a scene from the db after an edit. Scenes queued within reindexDelay of the first one are
+// written as one batch, and a scene edited several times in that window is only indexed once, so bulk edits don't
+// commit the index for every scene. Call FlushReindexQueue to write them straight away.
+func QueueReindex(sceneID string) {
+	sceneReindexer.queue(sceneID)
+}
+
+// FlushReindexQueue writes the scenes queued by QueueReindex without waiting for the delay, and waits until they
+// are in the index
+func FlushReindexQueue() {
+	sceneReindexer.flush()
+}
+
+// reindexer collects scene ids for a fixed delay after the first one and then writes them in batches
+type reindexer struct {
+	delay time.Duration
+	write func(sceneIDs []string)
+
+	mu      sync.Mutex
+	pending []string
+	queued  map[string]bool
+	timer   *time.Timer
+	writing sync.Mutex // batches are written one at a time, so a flush waits for a write started by the timer
+}
+
+func newReindexer(delay time.Duration, write func(sceneIDs []string)) *reindexer {
+	return &reindexer{delay: delay, write: write, queued: map[string]bool{}}
+}
+
+func (r *reindexer) queue(sceneID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.queued[sceneID] {
+		return
+	}
+	r.queued[sceneID] = true
+	r.pending = append(r.pending, sceneID)
+	// the window starts at the first edit, a steady stream of edits doesn't postpone the write
+	if r.timer == nil {
+		r.timer = time.AfterFunc(r.delay, r.flush)
+	}
+}
+
+func (r *reindexer) flush() {
+	r.writing.Lock()
+	defer r.writing.Unlock()
+
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = nil
+	r.queued = map[string]bool{}
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	r.mu.Unlock()
+
+	for len(pending) > 0 {
+		n := min(len(pending), indexBatchSize())
+		r.write(pending[:n])
+		pending = pending[n:]
+	}
+}
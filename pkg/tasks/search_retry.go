@@ -0,0 +1,121 @@
+package tasks
+
+import (
+	"encoding/json"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/xbapps/xbvr/pkg/models"
+)
+
+// searchIndexFailedKey is the KV entry listing the scenes IndexScenes could not index, RetryFailedIndexScenes
+// indexes them again
+const searchIndexFailedKey = "search_index_failed"
+
+// indexScenes writes the scenes to the index in batches with write. The scenes of a batch that failed are written
+// again one at a time once every batch was tried, the ids of the scenes that still fail are returned.
+func (i *Index) indexScenes(scenes []models.Scene, batchSize int, write func(*bleve.Batch) error) (indexed int, failed []string) {
+	var retry []models.Scene
+
+	batch := i.Bleve.NewBatch()
+	var pending []models.Scene
+	flush := func() {
+		if err := write(batch); err != nil {
+			log.Error(err)
+			retry = append(retry, pending...)
+		} else {
+			indexed += len(pending)
+		}
+		batch.Reset()
+		pending = nil
+	}
+	for _, scene := range scenes {
+		// indexing replaces any existing document, as data may have been updated
+		if err := i.BatchScene(batch, scene); err != nil {
+			log.Error(err)
+			retry = append(retry, scene)
+			continue
+		}
+		pending = append(pending, scene)
+		if batch.Size() >= batchSize {
+			flush()
+		}
+	}
+	if batch.Size() > 0 {
+		flush()
+	}
+
+	for _, scene := range retry {
+		batch := i.Bleve.NewBatch()
+		err := i.BatchScene(batch, scene)
+		if err == nil {
+			err = write(batch)
+		}
+		if err != nil {
+			log.Errorf("Scene %v could not be indexed: %v", scene.SceneID, err)
+			failed = append(failed, scene.SceneID)
+			continue
+		}
+		indexed++
+	}
+	return indexed, failed
+}
+
+// failedIndexScenes returns the ids saved by saveFailedIndexScenes
+func failedIndexScenes() []string {
+	var kv models.KV
+	db, _ := models.GetDB()
+	db.Where(&models.KV{Key: searchIndexFailedKey}).First(&kv)
+	db.Close()
+
+	var ids []string
+	if kv.Value != "" {
+		json.Unmarshal([]byte(kv.Value), &ids)
+	}
+	return ids
+}
+
+// saveFailedIndexScenes replaces the list of scenes waiting to be indexed again
+func saveFailedIndexScenes(ids []string) {
+	if ids == nil {
+		ids = []string{}
+	}
+	value, _ := json.Marshal(ids)
+	kv := models.KV{Key: searchIndexFailedKey, Value: string(value)}
+	kv.Save()
+}
+
+// addFailedIndexScenes adds ids to the scenes waiting to be indexed again
+func addFailedIndexScenes(ids []string) {
+	saved := failedIndexScenes()
+	seen := map[string]bool{}
+	for _, id := range saved {
+		seen[id] = true
+	}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			saved = append(saved, id)
+		}
+	}
+	saveFailedIndexScenes(saved)
+}
+
+// RetryFailedIndexScenes indexes the scenes IndexScenes could not index again, from the db. Scenes no longer in the
+// db leave the list, the ones failing again are kept for the next retry, and all of them when the batch cannot be
+// written.
+func RetryFailedIndexScenes() error {
+	return retryFailedIndexScenes(failedIndexScenes(), IndexScenesByIDs, saveFailedIndexScenes)
+}
+
+func retryFailedIndexScenes(ids []string, reindex func(ids []string) (SceneIndexResult, error), save func(ids []string)) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	result, err := reindex(ids)
+	if err != nil {
+		return err
+	}
+	save(result.Failed)
+	log.Infof("Retried %v scenes that could not be indexed, %v are no longer in the db, %v failed again", len(ids), len(result.Missing), len(result.Failed))
+	return nil
+}
@@ -0,0 +1,103 @@
+package tasks
+
+import (
+	"github.com/blevesearch/bleve/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/xbapps/xbvr/pkg/models"
+)
+
+// SceneIndexResult counts the scenes IndexScenesByIDs reindexed. Missing lists the ids that are not in the db, their
+// documents were removed. Failed lists the scenes that could not be indexed, their documents were left as they were.
+type SceneIndexResult struct {
+	Indexed int      `json:"indexed"`
+	Missing []string `json:"missing"`
+	Failed  []string `json:"failed"`
+}
+
+// IndexScenesByIDs reindexes the given scenes from the db as one batch, the targeted counterpart of SearchIndex,
+// eg after fixing the metadata of a few scenes. The document of a scene no longer in the db is removed. It does not
+// take the "index" lock, like ReindexScene.
+func IndexScenesByIDs(ids []string) (SceneIndexResult, error) {
+	idx, err := GetSceneIndex()
+	if err != nil {
+		return SceneIndexResult{}, err
+	}
+	result, err := idx.indexScenesByIDs(ids, loadScenesByIDs, idx.BatchScene)
+	if err != nil {
+		return result, err
+	}
+	log.WithFields(logrus.Fields{"task": "scrape"}).Infof("Reindexed %v selected scenes, %v not in the db, %v failed", result.Indexed, len(result.Missing), len(result.Failed))
+	return result, nil
+}
+
+// loadScenesByIDs reads the scenes with the fields they are indexed with, ids not in the db are left out
+func loadScenesByIDs(ids []string) ([]models.Scene, error) {
+	db, _ := models.GetDB()
+	defer db.Close()
+
+	var scenes []models.Scene
+	for start := 0; start < len(ids); start += 100 {
+		end := min(start+100, len(ids))
+		var page []models.Scene
+		err := db.Model(models.Scene{}).Preload("Cast").Preload("Tags").Preload("Files").
+			Where("scene_id in (?)", ids[start:end]).Find(&page).Error
+		if err != nil {
+			return nil, err
+		}
+		scenes = append(scenes, page...)
+	}
+	return scenes, nil
+}
+
+func (i *Index) indexScenesByIDs(ids []string, load func(ids []string) ([]models.Scene, error), put func(*bleve.Batch, models.Scene) error) (SceneIndexResult, error) {
+	result := SceneIndexResult{Missing: []string{}, Failed: []string{}}
+
+	seen := map[string]bool{}
+	var unique []string
+	for _, id := range ids {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) == 0 {
+		return result, nil
+	}
+
+	scenes, err := load(unique)
+	if err != nil {
+		return result, err
+	}
+
+	batch := i.Bleve.NewBatch()
+	inDB := map[string]bool{}
+	failed := map[string]bool{}
+	for _, scene := range scenes {
+		inDB[scene.SceneID] = true
+		if err := put(batch, scene); err != nil {
+			log.Error(err)
+			failed[scene.SceneID] = true
+		}
+	}
+	// only the scenes gone from the db are deleted, a scene that could not be indexed keeps its old document
+	for _, id := range unique {
+		if !inDB[id] {
+			batch.Delete(id)
+		}
+	}
+	if err := i.Batch(batch); err != nil {
+		return result, err
+	}
+
+	for _, id := range unique {
+		switch {
+		case !inDB[id]:
+			result.Missing = append(result.Missing, id)
+		case failed[id]:
+			result.Failed = append(result.Failed, id)
+		default:
+			result.Indexed++
+		}
+	}
+	return result, nil
+}
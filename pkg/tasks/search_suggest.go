@@ -0,0 +1,128 @@
+package tasks
+
+import (
+	"sort"
+	"strings"
+
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// maxSuggestions is the most "did you mean" queries offered for a search without results
+const maxSuggestions = 3
+
+// suggestionFields are the fields whose terms misspelled words are corrected to
+var suggestionFields = []string{"title", "cast"}
+
+type suggestedTerm struct {
+	term     string
+	distance uint8
+	count    uint64
+}
+
+// suggestions offers corrected spellings of q from the title and cast terms in the index, for a search that matched
+// nothing. Each word close to but not itself a term is replaced by the nearest terms, the most common first, the
+// fielded parts of q are left out. It returns nil when no word could be corrected.
+func (i *Index) suggestions(q string) ([]string, error) {
+	advanced, err := i.Bleve.Advanced()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := advanced.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	fuzzy, ok := reader.(index.IndexReaderFuzzy)
+	if !ok {
+		return nil, nil
+	}
+
+	words := strings.Fields(strings.ToLower(unfieldedWords(q)))
+	corrections := make([][]string, len(words))
+	corrected := false
+	for w, word := range words {
+		corrections[w] = []string{word}
+		terms, err := nearestTerms(fuzzy, word)
+		if err != nil {
+			return nil, err
+		}
+		if len(terms) > 0 && terms[0].distance > 0 {
+			corrections[w] = nil
+			for _, t := range terms {
+				corrections[w] = append(corrections[w], t.term)
+			}
+			corrected = true
+		}
+	}
+	if !corrected {
+		return nil, nil
+	}
+
+	// the nth suggestion uses the nth nearest term of each corrected word, or its nearest when it has fewer
+	var suggestions []string
+	seen := map[string]bool{}
+	for n := 0; n < maxSuggestions; n++ {
+		var parts []string
+		for _, c := range corrections {
+			parts = append(parts, c[min(n, len(c)-1)])
+		}
+		s := strings.Join(parts, " ")
+		if !seen[s] {
+			seen[s] = true
+			suggestions = append(suggestions, s)
+		}
+	}
+	return suggestions, nil
+}
+
+// nearestTerms returns the title and cast terms within reach of word, nearest and then most common first. A word
+// that is a term itself comes first with a distance of 0.
+func nearestTerms(reader index.IndexReaderFuzzy, word string) ([]suggestedTerm, error) {
+	length := len([]rune(word))
+	if length < 3 {
+		return nil, nil
+	}
+	fuzziness := 1
+	if length >= minFuzzyWordLength {
+		fuzziness = maxSearchFuzziness
+	}
+
+	found := map[string]*suggestedTerm{}
+	for _, field := range suggestionFields {
+		dict, err := reader.FieldDictFuzzy(field, word, fuzziness, "")
+		if err != nil {
+			return nil, err
+		}
+		entry, err := dict.Next()
+		for err == nil && entry != nil {
+			if t, ok := found[entry.Term]; ok {
+				t.count += entry.Count
+			} else {
+				found[entry.Term] = &suggestedTerm{term: entry.Term, distance: entry.EditDistance, count: entry.Count}
+			}
+			entry, err = dict.Next()
+		}
+		dict.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	terms := make([]suggestedTerm, 0, len(found))
+	for _, t := range found {
+		terms = append(terms, *t)
+	}
+	sort.Slice(terms, func(a, b int) bool {
+		if terms[a].distance != terms[b].distance {
+			return terms[a].distance < terms[b].distance
+		}
+		if terms[a].count != terms[b].count {
+			return terms[a].count > terms[b].count
+		}
+		return terms[a].term < terms[b].term
+	})
+	if len(terms) > maxSuggestions {
+		terms = terms[:maxSuggestions]
+	}
+	return terms, nil
+}
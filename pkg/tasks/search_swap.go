@@ -0,0 +1,161 @@
+package tasks
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/xbapps/xbvr/pkg/models"
+)
+
+// A forced rebuild builds the new scene index next to the live one, which keeps serving searches, and renames it into
+// place once it is complete. Disk space for both indexes is needed while it runs.
+const (
+	rebuildIndexSuffix = ".rebuild"
+	oldIndexSuffix     = ".old"
+)
+
+// rebuildSceneIndex builds a new, empty scene index with build and swaps it in for the live one, which is removed.
+// Searches use the live index until the swap and are only held up for finish and the rename. finish runs while writes
+// to the live index are held, anything written to the live index since build read the db has to be redone by it.
+func rebuildSceneIndex(build func(idx *Index) error, finish func(idx *Index) error) error {
+	path := sceneIndexPath() + rebuildIndexSuffix
+	// left behind by a rebuild that did not finish
+	if err := removeIndexFiles(path); err != nil {
+		return err
+	}
+
+	idx, err := newIndexAt(path)
+	if err != nil {
+		return err
+	}
+	if err := build(idx); err != nil {
+		idx.Bleve.Close()
+		removeIndexFiles(path)
+		return err
+	}
+	return swapSceneIndex(idx, path, finish)
+}
+
+// swapSceneIndex renames the index built at path over the live scene index and makes it the shared handle. Writes
+// waiting for the live index are made to the swapped one once it is open.
+func swapSceneIndex(idx *Index, path string, finish func(idx *Index) error) error {
+	sceneIndexMu.Lock()
+	defer sceneIndexMu.Unlock()
+
+	livePath := sceneIndexPath()
+	oldPath := livePath + oldIndexSuffix
+
+	// nothing is written to the live index after finish has caught up, the swapped index would lose it
+	live := sceneIndex
+	if live != nil {
+		live.writeMu.Lock()
+		defer live.writeMu.Unlock()
+	}
+	if err := finish(idx); err != nil {
+		idx.Bleve.Close()
+		removeIndexFiles(path)
+		return err
+	}
+
+	// the index files must be closed before they can be renamed on Windows, closing waits for running searches
+	if err := idx.Bleve.Close(); err != nil {
+		return err
+	}
+	if live != nil {
+		live.Bleve.Close()
+		sceneIndex = nil
+	}
+
+	if _, err := os.Stat(oldPath); err == nil {
+		log.Warnf("Removing the previous search index left at %v by an earlier rebuild", oldPath)
+	}
+	if err := removeIndexFiles(oldPath); err != nil {
+		return err
+	}
+	if _, err := os.Stat(livePath); err == nil {
+		if err := renameIndexFiles(livePath, oldPath); err != nil {
+			return err
+		}
+	}
+	if err := renameIndexFiles(path, livePath); err != nil {
+		// the old index is put back, it is reopened by the next GetSceneIndex call
+		renameIndexFiles(oldPath, livePath)
+		return err
+	}
+
+	swapped, err := newIndexAt(livePath)
+	if err != nil {
+		log.Errorf("The rebuilt search index at %v could not be opened, the previous index is kept at %v until the next rebuild: %v", livePath, oldPath, err)
+		return err
+	}
+	sceneIndex = swapped
+	if live != nil {
+		live.replacedBy = swapped
+	}
+	return removeIndexFiles(oldPath)
+}
+
+// renameIndexFiles moves an index and the version file kept next to it
+func renameIndexFiles(from string, to string) error {
+	if err := os.Rename(from, to); err != nil {
+		return err
+	}
+	if err := os.Rename(indexMetaPath(from), indexMetaPath(to)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func removeIndexFiles(path string) error {
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	if err := os.Remove(indexMetaPath(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// searchSceneIndex runs req on the shared scene index. A search that got the index just as a rebuild swapped it
+// finds it closed, it is run again on the new one.
+func searchSceneIndex(req *bleve.SearchRequest) (*Index, *bleve.SearchResult, error) {
+	for attempt := 0; ; attempt++ {
+		idx, err := GetSceneIndex()
+		if err != nil {
+			return nil, nil, err
+		}
+		res, err := idx.Bleve.Search(req)
+		if errors.Is(err, bleve.ErrorIndexClosed) && attempt == 0 {
+			continue
+		}
+		return idx, res, err
+	}
+}
+
+// indexScenesUpdatedSince writes the scenes saved since t to idx, a rebuild catches up with the scenes saved to the
+// live index while it was reading the db
+func indexScenesUpdatedSince(idx *Index, t time.Time) error {
+	db, _ := models.GetDB()
+	defer db.Close()
+
+	tx := db.Model(models.Scene{}).Preload("Cast").Preload("Tags").Preload("Files").
+		Where("updated_at >= ?", t).Order("id")
+	batcher := newSceneBatcher(idx, indexBatchSize())
+	for offset := 0; ; offset += 100 {
+		var scenes []models.Scene
+		if err := tx.Offset(offset).Limit(100).Find(&scenes).Error; err != nil {
+			return err
+		}
+		if len(scenes) == 0 {
+			break
+		}
+		for i := range scenes {
+			if err := batcher.add(scenes[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return batcher.flush()
+}
@@ -0,0 +1,2975 @@
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/document"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/xbapps/xbvr/pkg/config"
+	"github.com/xbapps/xbvr/pkg/models"
+
+	// before models initialises, see the package
+	_ "github.com/xbapps/xbvr/pkg/internal/testflags"
+)
+
+func newTestIndex(t testing.TB) *Index {
+	t.Helper()
+	idx, err := newIndexAt(filepath.Join(t.TempDir(), "scenes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { idx.Bleve.Close() })
+	return idx
+}
+
+func TestPutSceneReleaseDateIsUTC(t *testing.T) {
+	idx := newTestIndex(t)
+
+	// late evening in UTC+10 is still the previous day in UTC, the indexed date must follow the release date as entered
+	zone := time.FixedZone("UTC+10", 10*60*60)
+	scene := models.Scene{SceneID: "test-release", Title: "Release", ReleaseDate: time.Date(2023, 5, 14, 23, 30, 0, 0, zone)}
+	if err := idx.PutScene(scene); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := idx.Bleve.Document(scene.SceneID)
+	if err != nil || doc == nil {
+		t.Fatalf("document not indexed: %v", err)
+	}
+	var released time.Time
+	doc.VisitFields(func(field index.Field) {
+		if f, ok := field.(*document.DateTimeField); ok && field.Name() == "released" {
+			released, _, _ = f.DateTime()
+		}
+	})
+
+	expected := time.Date(2023, 5, 14, 0, 0, 0, 0, time.UTC)
+	if !released.Equal(expected) {
+		t.Errorf("released = %v, expected %v", released.UTC(), expected)
+	}
+}
+
+func TestCleanFilenameConfiguredStripWords(t *testing.T) {
+	saved := config.Config.Advanced.FilenameStripWords
+	t.Cleanup(func() { config.Config.Advanced.FilenameStripWords = saved })
+	config.Config.Advanced.FilenameStripWords = []string{"vrca360", "AV1"}
+
+	got := CleanFilename("Scene_Title_VRCA360_av1_8K_h265.mp4")
+	if got != "Scene Title" {
+		t.Errorf("CleanFilename = %q, expected %q", got, "Scene Title")
+	}
+}
+
+func TestCleanFilenameReleaseCodes(t *testing.T) {
+	tests := []struct {
+		filename string
+		expected string
+	}{
+		{"pxvr258.mp4", "pxvr258 pxvr-258 pxvr 258 pxvr00258"},
+		{"PXVR-00258.mp4", "PXVR 00258 PXVR00258"},
+		{"SLR_Studio_PXVR258_8K.mp4", "SLR Studio PXVR258 PXVR-258 PXVR 258 PXVR00258"},
+		{"PXVR 258.mp4", "PXVR 258 PXVR00258 PXVR258"},
+	}
+	for _, tt := range tests {
+		if got := CleanFilename(tt.filename); got != tt.expected {
+			t.Errorf("CleanFilename(%q) = %q, expected %q", tt.filename, got, tt.expected)
+		}
+	}
+}
+
+func TestCleanFilenameWithCode(t *testing.T) {
+	tests := []struct {
+		filename string
+		cleaned  string
+		codes    []string
+	}{
+		{"SLR_Studio_PXVR258_8K.mp4", "SLR Studio PXVR258", []string{"PXVR258", "PXVR-258", "PXVR 258", "PXVR00258"}},
+		{"PXVR 258.mp4", "PXVR 258", []string{"PXVR 258", "PXVR00258", "PXVR258"}},
+		{"Scene_Title_4K.mp4", "Scene Title", nil},
+	}
+	for _, tt := range tests {
+		cleaned, codes := CleanFilenameWithCode(tt.filename)
+		if cleaned != tt.cleaned {
+			t.Errorf("CleanFilenameWithCode(%q) cleaned = %q, expected %q", tt.filename, cleaned, tt.cleaned)
+		}
+		if !reflect.DeepEqual(codes, tt.codes) {
+			t.Errorf("CleanFilenameWithCode(%q) codes = %q, expected %q", tt.filename, codes, tt.codes)
+		}
+	}
+}
+
+func TestCleanFilenamePossessives(t *testing.T) {
+	for filename, expected := range map[string]string{
+		"Riley_s_Best_Day.mp4": "Riley's Best Day",
+		"Riley.s.Best.Day.mp4": "Riley's Best Day",
+		"Best_of_Riley-s.mp4":  "Best of Riley's",
+		"Riley's Best Day.mp4": "Riley's Best Day",
+		"Studio s Best.mp4":    "Studio s Best",
+		"group s scene.mp4":    "group s scene",
+		"Sisters_Scene.mp4":    "Sisters Scene",
+	} {
+		if got := CleanFilename(filename); got != expected {
+			t.Errorf("CleanFilename(%q) = %q, expected %q", filename, got, expected)
+		}
+	}
+}
+
+func TestCleanFilenameBrackets(t *testing.T) {
+	for filename, expected := range map[string]string{
+		"Title [1080p] (VR).mp4":               "Title",
+		"Beach Day [SiteRip] {WebDL}.mp4":      "Beach Day",
+		"Beach Day (Riley Reid) [4K].mp4":      "Beach Day Riley Reid",
+		"[Studio] Beach_Day (180) (60fps).mp4": "Beach Day",
+		"[Beach Day].mp4":                      "Beach Day",
+		"(Beach Day) [1080p].mp4":              "Beach Day",
+	} {
+		if got := CleanFilename(filename); got != expected {
+			t.Errorf("CleanFilename(%q) = %q, expected %q", filename, got, expected)
+		}
+	}
+}
+
+func TestCleanFilenameSiteAliases(t *testing.T) {
+	saved := config.Config.Advanced.FilenameSiteAliases
+	t.Cleanup(func() { config.Config.Advanced.FilenameSiteAliases = saved })
+	config.Config.Advanced.FilenameSiteAliases = map[string]string{"MilfVR": "MILF VR", "czechvrfetish": "Fetish By Czech VR"}
+
+	for filename, expected := range map[string]string{
+		"czechvr_beach_day.mp4":       "Czech VR beach day",
+		"CzechVR-Beach-Day.mp4":       "Czech VR Beach Day",
+		"milfvr.beach.day.mp4":        "MILF VR beach day",
+		"czechvrfetish_beach_day.mp4": "Fetish By Czech VR beach day",
+		"wankzvr_beach_day.mp4":       "wankzvr beach day",
+		"beach_day_czechvr.mp4":       "beach day Czech VR",
+	} {
+		if got, _ := CleanFilenameWithCode(filename); got != expected {
+			t.Errorf("CleanFilenameWithCode(%q) = %q, expected %q", filename, got, expected)
+		}
+	}
+}
+
+func TestCleanFilenameConfiguredCodePatterns(t *testing.T) {
+	saved := config.Config.Advanced.FilenameCodePatterns
+	t.Cleanup(func() { config.Config.Advanced.FilenameCodePatterns = saved })
+	config.Config.Advanced.FilenameCodePatterns = []config.FilenameCodePattern{
+		{Pattern: `(?i)(3DSVR)[-_ ]?(\d{3,5})`, Variants: []string{"${1}-${2}", "${1}${2}", "${1} ${2}"}},
+		{Pattern: `(`, Variants: []string{"invalid"}},
+	}
+
+	cleaned, codes := CleanFilenameWithCode("Scene_Title_3DSVR-1234_8K.mp4")
+	if cleaned != "Scene Title 3DSVR 1234" {
+		t.Errorf("cleaned = %q, expected %q", cleaned, "Scene Title 3DSVR 1234")
+	}
+	for _, expected := range []string{"3DSVR-1234", "3DSVR1234", "3DSVR 1234"} {
+		found := false
+		for _, code := range codes {
+			found = found || code == expected
+		}
+		if !found {
+			t.Errorf("codes %q are missing %q", codes, expected)
+		}
+	}
+	if got := CleanFilename("Scene_Title_3DSVR-1234_8K.mp4"); !strings.Contains(got, "3DSVR-1234") || !strings.Contains(got, "3DSVR1234") {
+		t.Errorf("CleanFilename = %q, expected the configured variants", got)
+	}
+}
+
+func TestCastQueryQuotedFullName(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-reid", Title: "One", Cast: []models.Actor{{Name: "Riley Reid"}}},
+		{SceneID: "test-steele", Title: "Two", Cast: []models.Actor{{Name: "Riley Steele"}, {Name: "Reid Moore"}}},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{`"Riley Reid"`, []string{"test-reid"}},
+		{`"riley steele"`, []string{"test-steele"}},
+		{`"Riley"`, nil},
+		{"Riley", []string{"test-reid", "test-steele"}},
+	}
+	for _, tt := range tests {
+		req := bleve.NewSearchRequest(castQuery(tt.name))
+		req.SortBy([]string{"_id"})
+		res, err := idx.Bleve.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+			t.Errorf("castQuery(%s) matched %v, expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestCastNamesQuery(t *testing.T) {
+	idx := newTestIndex(t)
+
+	reid := models.Actor{Name: "Riley Reid"}
+	danger := models.Actor{Name: "Abella Danger"}
+	scenes := []models.Scene{
+		{SceneID: "test-pair", Cast: []models.Actor{reid, danger}},
+		{SceneID: "test-reid", Cast: []models.Actor{reid}},
+		{SceneID: "test-danger", Cast: []models.Actor{danger, {Name: "Riley Steele"}}},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		names    []string
+		matchAll bool
+		expected []string
+	}{
+		{[]string{"Riley Reid", `"Abella Danger"`}, true, []string{"test-pair"}},
+		{[]string{"Riley Reid", "abella danger"}, false, []string{"test-danger", "test-pair", "test-reid"}},
+		{[]string{"Riley Reid"}, true, []string{"test-pair", "test-reid"}},
+		{[]string{"Riley"}, false, nil},
+		{[]string{"", `""`}, false, nil},
+	}
+	for _, tt := range tests {
+		req := bleve.NewSearchRequest(castNamesQuery(tt.names, tt.matchAll))
+		req.SortBy([]string{"_id"})
+		res, err := idx.Bleve.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("cast %q matchAll %v matched %v, expected %v", tt.names, tt.matchAll, got, tt.expected)
+		}
+	}
+}
+
+func TestCleanFilenameLeadingDates(t *testing.T) {
+	tests := []struct {
+		filename string
+		expected string
+	}{
+		{"2023-05-14 Studio Title.mp4", "Studio Title"},
+		{"20230514_Studio_Title.mp4", "Studio Title"},
+		{"1684022400-Studio.Title.mp4", "Studio Title"},
+		{"2023-05-14_1684022400_Studio_Title.mp4", "Studio Title"},
+		{"258 Studio Title.mp4", "258 Studio Title"},
+		{"20231399 Studio Title.mp4", "20231399 Studio Title"},
+		{"2023-05-14.mp4", "2023 05 14"},
+	}
+	for _, tt := range tests {
+		if got := CleanFilename(tt.filename); got != tt.expected {
+			t.Errorf("CleanFilename(%q) = %q, expected %q", tt.filename, got, tt.expected)
+		}
+	}
+}
+
+func TestCJKTitleAnalyzer(t *testing.T) {
+	saved := config.Config.Advanced.SearchTitleAnalyzer
+	t.Cleanup(func() { config.Config.Advanced.SearchTitleAnalyzer = saved })
+	config.Config.Advanced.SearchTitleAnalyzer = "cjk"
+
+	idx := newTestIndex(t)
+	if idx.AnalyzersOutdated() {
+		t.Fatal("new index reported as built with different analyzers")
+	}
+	if err := idx.PutScene(models.Scene{SceneID: "test-cjk", Title: "東京の素人娘と温泉旅行"}); err != nil {
+		t.Fatal(err)
+	}
+
+	q := bleve.NewMatchQuery("素人娘")
+	q.SetField("title")
+	res, err := idx.Bleve.Search(bleve.NewSearchRequest(q))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 1 {
+		t.Errorf("substring of a Japanese title matched %v scenes, expected 1", res.Total)
+	}
+
+	config.Config.Advanced.SearchTitleAnalyzer = "simple"
+	if !idx.AnalyzersOutdated() {
+		t.Error("changed title analyzer not reported")
+	}
+}
+
+func TestStemmedDescriptionAnalyzer(t *testing.T) {
+	savedDescription := config.Config.Advanced.SearchDescriptionAnalyzer
+	savedSearchable := config.Config.Advanced.SearchStemSearchable
+	t.Cleanup(func() {
+		config.Config.Advanced.SearchDescriptionAnalyzer = savedDescription
+		config.Config.Advanced.SearchStemSearchable = savedSearchable
+	})
+
+	search := func(idx *Index, q query.Query) uint64 {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Total
+	}
+	description := func(text string) query.Query {
+		q := bleve.NewMatchQuery(text)
+		q.SetField("description")
+		return q
+	}
+	scene := models.Scene{SceneID: "test-stem", Title: "Beach Day", Synopsis: "Running along the beach"}
+
+	config.Config.Advanced.SearchDescriptionAnalyzer = "standard"
+	config.Config.Advanced.SearchStemSearchable = false
+	idx := newTestIndex(t)
+	if err := idx.PutScene(scene); err != nil {
+		t.Fatal(err)
+	}
+	if got := search(idx, description("run")); got != 0 {
+		t.Errorf("run matched %v scenes in an unstemmed description, expected 0", got)
+	}
+
+	config.Config.Advanced.SearchDescriptionAnalyzer = "en"
+	config.Config.Advanced.SearchStemSearchable = true
+	if !idx.AnalyzersOutdated() {
+		t.Error("changed description and searchable analyzers not reported")
+	}
+	idx = newTestIndex(t)
+	if idx.AnalyzersOutdated() {
+		t.Fatal("new index reported as built with different analyzers")
+	}
+	if err := idx.PutScene(scene); err != nil {
+		t.Fatal(err)
+	}
+	if got := search(idx, description("run")); got != 1 {
+		t.Errorf("run matched %v scenes in a stemmed description, expected 1", got)
+	}
+	if got := search(idx, bleve.NewQueryStringQuery("runs")); got != 1 {
+		t.Errorf("runs without a field matched %v scenes with stemming, expected 1", got)
+	}
+}
+
+func TestCastAliasesIndexed(t *testing.T) {
+	idx := newTestIndex(t)
+
+	actor := models.Actor{Name: "Riley Reid", Aliases: `["Paige Riley","Riley Reed"]`}
+	if err := idx.PutScene(models.Scene{SceneID: "test-alias", Title: "Alias", Cast: []models.Actor{actor}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, q := range []string{`cast:"paige riley"`, "cast:paigeriley", `cast:"riley reed"`, `cast:"riley reid"`} {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(bleve.NewQueryStringQuery(q)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != 1 {
+			t.Errorf("%s matched %v scenes, expected 1", q, res.Total)
+		}
+	}
+}
+
+func TestPrefixSearchQuery(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-riley", Title: "Morning Workout", Cast: []models.Actor{{Name: "Riley Reid"}}},
+		{SceneID: "test-rachel", Title: "Morning Coffee", Cast: []models.Actor{{Name: "Rachel Starr"}}},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		q        string
+		expected uint64
+	}{
+		{"cast:ril", 1},
+		{"cast:RIL*", 1},
+		{"mor", 2},
+		{"mor cast:rac", 1},
+		{"cast:r", 0}, // too short to search
+		{"site:ril", 0},
+	}
+	for _, tt := range tests {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(textQuery(tt.q, SearchModePrefix)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != tt.expected {
+			t.Errorf("prefix search %q matched %v scenes, expected %v", tt.q, res.Total, tt.expected)
+		}
+	}
+}
+
+func TestStoredSceneMatchesIndexedDocument(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scene := models.Scene{
+		SceneID:     "test-dump",
+		Title:       "Dump",
+		Synopsis:    "Stored fields",
+		Site:        "VR Site",
+		Studio:      "VR Studio",
+		Duration:    42,
+		IsWatched:   true,
+		ReleaseDate: time.Date(2023, 5, 14, 0, 0, 0, 0, time.UTC),
+		Cast:        []models.Actor{{Name: "Riley Reid"}, {Name: "Riley Steele"}},
+		Tags:        []models.Tag{{Name: "pov"}},
+		Files:       []models.File{{Type: "video", VideoHeight: 2160}},
+	}
+	scene.CreatedAt = time.Date(2023, 6, 1, 12, 30, 0, 0, time.UTC)
+	if err := idx.PutScene(scene); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := idx.storedScene(scene.SceneID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := sceneDocument(scene); !reflect.DeepEqual(got, expected) {
+		t.Errorf("stored document = %+v, expected %+v", got, expected)
+	}
+
+	if _, err := idx.storedScene("test-missing"); err == nil {
+		t.Error("expected an error for a scene that is not indexed")
+	}
+}
+
+func TestSearchAcrossFields(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-both", Title: "Beach Day", Cast: []models.Actor{{Name: "Riley Reid"}}},
+		{SceneID: "test-title", Title: "Beach Beach", Synopsis: "A day at the beach", Tags: []models.Tag{{Name: "beach"}}},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := idx.Bleve.Search(bleve.NewSearchRequest(bleve.NewQueryStringQuery("beach riley")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 2 {
+		t.Fatalf("beach riley matched %v scenes, expected 2", res.Total)
+	}
+	if got := res.Hits[0].ID; got != "test-both" {
+		t.Errorf("%v ranked first, expected the scene matching both words", got)
+	}
+}
+
+func TestRecencyBoost(t *testing.T) {
+	idx := newTestIndex(t)
+
+	now := time.Now()
+	scenes := []models.Scene{
+		{SceneID: "test-new", Title: "Beach Day", ReleaseDate: now.AddDate(0, 0, -10)},
+		{SceneID: "test-old", Title: "Beach Day Beach", ReleaseDate: now.AddDate(-5, 0, 0)},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first := func(weight float64) string {
+		req := newSceneSearchRequest(idx.Bleve.Mapping(), bleve.NewQueryStringQuery("beach"), SceneSearchOptions{RecencyWeight: weight})
+		res, err := idx.Bleve.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != 2 {
+			t.Fatalf("recency weight %v matched %v scenes, expected 2", weight, res.Total)
+		}
+		return res.Hits[0].ID
+	}
+	if got := first(0); got != "test-old" {
+		t.Errorf("without a recency weight %v ranked first, expected the better text match", got)
+	}
+	if got := first(1); got != "test-new" {
+		t.Errorf("with a recency weight %v ranked first, expected the newer scene", got)
+	}
+}
+
+func TestCleanFilenameCamelCase(t *testing.T) {
+	tests := []struct {
+		filename string
+		expected string
+	}{
+		{"RileyReidPOVFuck.mp4", "Riley Reid POV Fuck"},
+		{"StudioNameSceneTitleHere.mp4", "Studio Name Scene Title Here"},
+		{"SLRStudio_Title_8K.mp4", "SLR Studio Title"},
+		{"PXVR258.mp4", "PXVR258 PXVR-258 PXVR 258 PXVR00258"},
+		{"VR Scene Title.mp4", "VR Scene Title"},
+	}
+	for _, tt := range tests {
+		if got := CleanFilename(tt.filename); got != tt.expected {
+			t.Errorf("CleanFilename(%q) = %q, expected %q", tt.filename, got, tt.expected)
+		}
+	}
+}
+
+func TestSearchRequestSize(t *testing.T) {
+	saved := config.Config.Web.SearchPageSize
+	t.Cleanup(func() { config.Config.Web.SearchPageSize = saved })
+	config.Config.Web.SearchPageSize = 50
+
+	idx := newTestIndex(t)
+	tests := []struct {
+		requested int
+		expected  int
+	}{
+		{0, 50},
+		{10, 10},
+		{MaxSearchPageSize, MaxSearchPageSize},
+		{5000, MaxSearchPageSize},
+	}
+	for _, tt := range tests {
+		req := newSceneSearchRequest(idx.Bleve.Mapping(), bleve.NewMatchAllQuery(), SceneSearchOptions{Size: tt.requested})
+		if req.Size != tt.expected {
+			t.Errorf("requested size %v searched for %v, expected %v", tt.requested, req.Size, tt.expected)
+		}
+	}
+}
+
+func syntheticScenes(n int) []models.Scene {
+	scenes := make([]models.Scene, n)
+	for i := range scenes {
+		scenes[i] = models.Scene{
+			SceneID:  fmt.Sprintf("synthetic-%v", i),
+			Title:    fmt.Sprintf("Synthetic scene number %v", i),
+			Synopsis: "A synthetic scene used to measure how fast the search index can be built",
+			Site:     fmt.Sprintf("Site %v", i%50),
+			Cast:     []models.Actor{{Name: fmt.Sprintf("Actor %v", i%500)}},
+			Tags:     []models.Tag{{Name: "synthetic"}, {Name: fmt.Sprintf("tag %v", i%20)}},
+			Duration: i % 90,
+		}
+	}
+	return scenes
+}
+
+// go test -run ^$ -bench BenchmarkIndexScenes -benchtime 1x ./pkg/tasks
+// indexing one document at a time took ~250s for 50k scenes, batches of 500 took ~11s
+func BenchmarkIndexScenes(b *testing.B) {
+	scenes := syntheticScenes(50000)
+
+	b.Run("single", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			idx := newTestIndex(b)
+			for i := range scenes {
+				if err := idx.PutScene(scenes[i]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("batch", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			idx := newTestIndex(b)
+			batch := idx.Bleve.NewBatch()
+			for i := range scenes {
+				if err := idx.BatchScene(batch, scenes[i]); err != nil {
+					b.Fatal(err)
+				}
+				if batch.Size() >= defaultIndexBatchSize {
+					if err := idx.Bleve.Batch(batch); err != nil {
+						b.Fatal(err)
+					}
+					batch.Reset()
+				}
+			}
+			if err := idx.Bleve.Batch(batch); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// go test -run ^$ -bench BenchmarkIndexScenesParallel -benchtime 1x ./pkg/tasks
+// bleve already analyses each batch on several goroutines, the workers only add mapping the documents and the existence
+// checks of a backfill in parallel, so the speedup on several cpus is well below linear.
+// With a single cpu every worker count took 13-17s for 50k scenes, the same as one batch.
+func BenchmarkIndexScenesParallel(b *testing.B) {
+	scenes := syntheticScenes(50000)
+
+	for _, workers := range []int{1, 2, 4, runtime.NumCPU()} {
+		b.Run(fmt.Sprintf("workers-%v", workers), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				idx := newTestIndex(b)
+				batcher := newSceneBatcher(idx, defaultIndexBatchSize)
+				queue := make(chan models.Scene, 100)
+				wg := indexSceneWorkers(batcher, workers, queue, nil)
+				for i := range scenes {
+					queue <- scenes[i]
+				}
+				close(queue)
+				wg.Wait()
+				if err := batcher.flush(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// go test -run ^$ -bench BenchmarkIndexMemory -benchtime 1x ./pkg/tasks
+// peak-MB is the largest heap seen while indexing 50k scenes in batches and waiting for the merges to finish.
+// On one cpu the default peaked at 255-273MB. The low memory scorch thresholds alone made no measurable difference
+// at this size (~251MB), with the smaller batches of low memory the peak was 187-191MB, 20-40% slower.
+func BenchmarkIndexMemory(b *testing.B) {
+	scenes := syntheticScenes(50000)
+
+	for _, lowMemory := range []bool{false, true} {
+		name := "default"
+		if lowMemory {
+			name = "low-memory"
+		}
+		b.Run(name, func(b *testing.B) {
+			saved := config.Config.Advanced.SearchIndexTuning
+			b.Cleanup(func() { config.Config.Advanced.SearchIndexTuning = saved })
+			config.Config.Advanced.SearchIndexTuning = config.SearchIndexTuning{LowMemory: lowMemory}
+
+			var peak uint64
+			for n := 0; n < b.N; n++ {
+				runtime.GC()
+				done := make(chan struct{})
+				sampled := make(chan uint64)
+				go func() {
+					var max uint64
+					var m runtime.MemStats
+					for {
+						runtime.ReadMemStats(&m)
+						if m.HeapAlloc > max {
+							max = m.HeapAlloc
+						}
+						select {
+						case <-done:
+							sampled <- max
+							return
+						case <-time.After(10 * time.Millisecond):
+						}
+					}
+				}()
+
+				path := filepath.Join(b.TempDir(), "scenes")
+				idx, err := newIndexAt(path)
+				if err != nil {
+					b.Fatal(err)
+				}
+				batch := idx.Bleve.NewBatch()
+				for i := range scenes {
+					if err := idx.BatchScene(batch, scenes[i]); err != nil {
+						b.Fatal(err)
+					}
+					if batch.Size() >= indexBatchSize() {
+						if err := idx.Bleve.Batch(batch); err != nil {
+							b.Fatal(err)
+						}
+						batch.Reset()
+					}
+				}
+				if err := idx.Bleve.Batch(batch); err != nil {
+					b.Fatal(err)
+				}
+				settledDirSize(path, time.Minute)
+				close(done)
+				idx.Bleve.Close()
+				if max := <-sampled; max > peak {
+					peak = max
+				}
+			}
+			b.ReportMetric(float64(peak)/(1<<20), "peak-MB")
+		})
+	}
+}
+
+func TestScorchConfig(t *testing.T) {
+	if cfg := scorchConfig(config.SearchIndexTuning{}); cfg != nil {
+		t.Errorf("default tuning gave scorch config %v, expected none", cfg)
+	}
+
+	cfg := scorchConfig(config.SearchIndexTuning{LowMemory: true, MaxSegmentSize: 50000})
+	merge, _ := cfg["scorchMergePlanOptions"].(map[string]interface{})
+	if merge["MaxSegmentSize"] != int64(50000) || merge["SegmentsPerMergeTask"] != lowMemoryTuning.SegmentsPerMergeTask {
+		t.Errorf("low memory merge options %v, expected the set segment size and the low memory merge task size", merge)
+	}
+	if _, ok := merge["MaxSegmentsPerTier"]; ok {
+		t.Errorf("low memory merge options %v set the segments per tier, which keeps the scorch default", merge)
+	}
+	persister, _ := cfg["scorchPersisterOptions"].(map[string]interface{})
+	if persister["MemoryPressurePauseThreshold"] != lowMemoryTuning.MemoryPressurePauseThreshold {
+		t.Errorf("low memory persister options %v, expected the low memory pause threshold", persister)
+	}
+
+	// the tuning is used when the index is opened, and isn't kept once it is turned off
+	saved := config.Config.Advanced.SearchIndexTuning
+	t.Cleanup(func() { config.Config.Advanced.SearchIndexTuning = saved })
+	config.Config.Advanced.SearchIndexTuning = config.SearchIndexTuning{LowMemory: true}
+	path := filepath.Join(t.TempDir(), "scenes")
+	for _, lowMemory := range []bool{true, true, false} {
+		config.Config.Advanced.SearchIndexTuning.LowMemory = lowMemory
+		idx, err := newIndexAt(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.PutScene(models.Scene{SceneID: "test-tuned", Title: "Beach Day"}); err != nil {
+			t.Fatal(err)
+		}
+		if count, _ := idx.Bleve.DocCount(); count != 1 {
+			t.Errorf("tuned index has %v documents, expected 1", count)
+		}
+		idx.Bleve.Close()
+	}
+	meta, err := os.ReadFile(filepath.Join(path, "index_meta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(meta), "scorchPersisterOptions") {
+		t.Errorf("the tuning was stored with the index: %s", meta)
+	}
+}
+
+func TestIndexSceneWorkers(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := syntheticScenes(250)
+	batcher := newSceneBatcher(idx, 40)
+	queue := make(chan models.Scene)
+	wg := indexSceneWorkers(batcher, 4, queue, func(scene models.Scene) bool {
+		return scene.SceneID == "synthetic-7"
+	})
+	for i := range scenes {
+		queue <- scenes[i]
+	}
+	close(queue)
+	wg.Wait()
+	if err := batcher.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := idx.Bleve.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 249 {
+		t.Errorf("indexed %v scenes, expected 249", count)
+	}
+	if idx.Exist("synthetic-7") {
+		t.Error("skipped scene was indexed")
+	}
+}
+
+func TestFilteredQueryExclusions(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-kept", Title: "Beach Day", Site: "VR Site", Duration: 30, Tags: []models.Tag{{Name: "pov"}}},
+		{SceneID: "test-tagged", Title: "Beach Day", Site: "VR Site", Duration: 30, Tags: []models.Tag{{Name: "outdoor"}, {Name: "pov"}}},
+		{SceneID: "test-site", Title: "Beach Day", Site: "Other Site", Duration: 30},
+		{SceneID: "test-short", Title: "Beach Day", Site: "VR Site", Duration: 5},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	minDur := 10
+	tests := []struct {
+		name     string
+		filter   SceneSearchFilter
+		expected []string
+	}{
+		{"no exclusions", SceneSearchFilter{}, []string{"test-kept", "test-short", "test-site", "test-tagged"}},
+		{"excluded tag", SceneSearchFilter{ExcludeTags: []string{"outdoor"}}, []string{"test-kept", "test-short", "test-site"}},
+		{"excluded site", SceneSearchFilter{ExcludeSites: []string{"Other Site"}}, []string{"test-kept", "test-short", "test-tagged"}},
+		{"exclusions with range", SceneSearchFilter{MinDuration: &minDur, ExcludeTags: []string{"outdoor"}, ExcludeSites: []string{"Other Site"}}, []string{"test-kept"}},
+	}
+	for _, tt := range tests {
+		req := bleve.NewSearchRequest(filteredQuery("beach", SearchModeQueryString, tt.filter))
+		req.SortBy([]string{"_id"})
+		res, err := idx.Bleve.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+			t.Errorf("%s matched %v, expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestMappingVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenes")
+
+	idx, err := newIndexAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.MappingOutdated() {
+		t.Error("new index reported as built with an older mapping")
+	}
+	idx.Bleve.Close()
+
+	idx, err = newIndexAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.MappingOutdated() {
+		t.Error("reopened index reported as built with an older mapping")
+	}
+	idx.Bleve.Close()
+
+	// indexes built before the version was recorded have no metadata file
+	if err := os.Remove(indexMetaPath(path)); err != nil {
+		t.Fatal(err)
+	}
+	idx, err = newIndexAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Bleve.Close()
+	if !idx.MappingOutdated() {
+		t.Error("index without a mapping version not reported as outdated")
+	}
+}
+
+func TestSceneSummaryFromStoredFields(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-pair", Title: "Beach Day", Site: "VR Site", Cast: []models.Actor{{Name: "Riley Reid"}, {Name: "Riley Steele"}}},
+		{SceneID: "test-solo", Title: "Beach Night", Site: "VR Site", Cast: []models.Actor{{Name: "Riley Reid"}}},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, scene := range scenes {
+		req := bleve.NewSearchRequest(bleve.NewDocIDQuery([]string{scene.SceneID}))
+		req.Fields = []string{"title", "cast_exact", "site"}
+		res, err := idx.Bleve.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Hits) != 1 {
+			t.Fatalf("%v matched %v scenes, expected 1", scene.SceneID, len(res.Hits))
+		}
+
+		got := sceneSummary(res.Hits[0])
+		var cast []string
+		for _, actor := range scene.Cast {
+			cast = append(cast, actor.Name)
+		}
+		if got.SceneID != scene.SceneID || got.Title != scene.Title || got.Site != scene.Site || !reflect.DeepEqual(got.Cast, cast) {
+			t.Errorf("summary = %+v, expected %v %v %v %v", got, scene.SceneID, scene.Title, scene.Site, cast)
+		}
+	}
+}
+
+func TestCoverURLStored(t *testing.T) {
+	idx := newTestIndex(t)
+
+	cover := "https://example.com/covers/beach-day.jpg"
+	if err := idx.PutScene(models.Scene{SceneID: "test-cover", Title: "Beach Day", CoverURL: cover}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := bleve.NewSearchRequest(bleve.NewDocIDQuery([]string{"test-cover"}))
+	req.Fields = []string{"title", "cast_exact", "site", "cover_url"}
+	res, err := idx.Bleve.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 1 {
+		t.Fatalf("test-cover matched %v scenes, expected 1", len(res.Hits))
+	}
+	if got := sceneSummary(res.Hits[0]).CoverURL; got != cover {
+		t.Errorf("summary cover url = %q, expected %q", got, cover)
+	}
+
+	// the url is stored but not indexed, so its words don't match searches
+	q := bleve.NewMatchQuery("covers")
+	q.SetField("cover_url")
+	res, err = idx.Bleve.Search(bleve.NewSearchRequest(q))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 0 {
+		t.Errorf("a search for covers matched %v scenes, the cover url should not be indexed", res.Total)
+	}
+}
+
+func TestIDPrefixQuery(t *testing.T) {
+	idx := newTestIndex(t)
+
+	for _, id := range []string{"slr-200", "slr-101", "vrb-slr-100", "slr-100", "slrx-100"} {
+		if err := idx.PutScene(models.Scene{SceneID: id, Title: "Prefix"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		prefix   string
+		expected []string
+	}{
+		{"slr-1", []string{"slr-100", "slr-101"}},
+		{"slr", []string{"slr-100", "slr-101", "slr-200", "slrx-100"}},
+		{"SLR-1", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		req := newSceneSearchRequest(idx.Bleve.Mapping(), idPrefixQuery(tt.prefix), SceneSearchOptions{SortBy: []string{"_id"}})
+		res, err := idx.Bleve.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("id prefix %q matched %v, expected %v", tt.prefix, got, tt.expected)
+		}
+	}
+}
+
+func TestMoveSearchIndex(t *testing.T) {
+	oldDir := t.TempDir()
+	newDir := filepath.Join(t.TempDir(), "index")
+
+	idx, err := newIndexAt(filepath.Join(oldDir, "scenes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Bleve.Close()
+
+	saved := config.Config.Storage.IndexPath
+	t.Cleanup(func() { config.Config.Storage.IndexPath = saved })
+	config.Config.Storage.IndexPath = oldDir
+
+	if err := MoveSearchIndex(newDir); err != nil {
+		t.Fatal(err)
+	}
+	if IndexDir() != newDir {
+		t.Errorf("index folder = %v, expected %v", IndexDir(), newDir)
+	}
+	for _, path := range []string{filepath.Join(newDir, "scenes"), indexMetaPath(filepath.Join(newDir, "scenes"))} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%v was not moved: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(oldDir, "scenes")); !os.IsNotExist(err) {
+		t.Error("index was left in the old folder")
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveSearchIndex(file); err == nil {
+		t.Error("expected an error for a folder that cannot be created")
+	}
+}
+
+func TestClearSceneIndex(t *testing.T) {
+	saved := config.Config.Storage.IndexPath
+	t.Cleanup(func() {
+		CloseSceneIndex()
+		config.Config.Storage.IndexPath = saved
+	})
+	CloseSceneIndex()
+	config.Config.Storage.IndexPath = t.TempDir()
+
+	idx, err := GetSceneIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.PutScene(models.Scene{SceneID: "test-cleared", Title: "Beach Day"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeSceneIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(indexMetaPath(sceneIndexPath())); !os.IsNotExist(err) {
+		t.Error("the index version file was left behind")
+	}
+
+	idx, err = GetSceneIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := idx.Bleve.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("%v documents after clearing, expected 0", count)
+	}
+}
+
+func TestRebuildSceneIndexKeepsSearching(t *testing.T) {
+	saved := config.Config.Storage.IndexPath
+	t.Cleanup(func() {
+		CloseSceneIndex()
+		config.Config.Storage.IndexPath = saved
+	})
+	CloseSceneIndex()
+	config.Config.Storage.IndexPath = t.TempDir()
+
+	idx, err := GetSceneIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.PutScene(models.Scene{SceneID: "test-old", Title: "Beach Day"}); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	var searches, failures int
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_, res, err := searchSceneIndex(bleve.NewSearchRequest(filteredQuery("beach", SearchModeQueryString, SceneSearchFilter{})))
+			searches++
+			if err != nil || len(res.Hits) == 0 {
+				failures++
+			}
+		}
+	}()
+
+	err = rebuildSceneIndex(func(idx *Index) error {
+		for _, scene := range []models.Scene{{SceneID: "test-old", Title: "Beach Day"}, {SceneID: "test-new", Title: "Beach Night"}} {
+			if err := idx.PutScene(scene); err != nil {
+				return err
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		return nil
+	}, func(idx *Index) error { return nil })
+	// keep searching for a moment on the swapped index
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if searches == 0 || failures > 0 {
+		t.Errorf("%v of %v searches failed during the rebuild", failures, searches)
+	}
+	_, res, err := searchSceneIndex(bleve.NewSearchRequest(filteredQuery("beach", SearchModeQueryString, SceneSearchFilter{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 2 {
+		t.Errorf("%v matches after the rebuild, expected both scenes of the rebuilt index", res.Total)
+	}
+	for _, path := range []string{sceneIndexPath() + rebuildIndexSuffix, sceneIndexPath() + oldIndexSuffix, indexMetaPath(sceneIndexPath() + oldIndexSuffix)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%v was left behind", path)
+		}
+	}
+	if _, err := os.Stat(indexMetaPath(sceneIndexPath())); err != nil {
+		t.Errorf("the version file of the rebuilt index was not moved: %v", err)
+	}
+}
+
+func TestRebuildSceneIndexHoldsLiveWrites(t *testing.T) {
+	saved := config.Config.Storage.IndexPath
+	t.Cleanup(func() {
+		CloseSceneIndex()
+		config.Config.Storage.IndexPath = saved
+	})
+	CloseSceneIndex()
+	config.Config.Storage.IndexPath = t.TempDir()
+
+	live, err := GetSceneIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := live.PutScene(models.Scene{SceneID: "test-old", Title: "Beach Day"}); err != nil {
+		t.Fatal(err)
+	}
+
+	written := make(chan error, 1)
+	err = rebuildSceneIndex(func(idx *Index) error {
+		for _, id := range []string{"test-old", "test-deleted"} {
+			if err := idx.PutScene(models.Scene{SceneID: id, Title: "Beach Day"}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(idx *Index) error {
+		// a reindex made to the live handle once the catch up has read the db
+		go func() { written <- live.PutScene(models.Scene{SceneID: "test-late", Title: "Beach Night"}) }()
+		select {
+		case err := <-written:
+			return fmt.Errorf("the live index was written during the swap: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		_, err := idx.pruneDeletedScenes(false, func(ids []string) ([]string, error) {
+			var existing []string
+			for _, id := range ids {
+				if id != "test-deleted" {
+					existing = append(existing, id)
+				}
+			}
+			return existing, nil
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("the held write failed: %v", err)
+	}
+
+	idx, err := GetSceneIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx == live {
+		t.Fatal("the rebuilt index was not swapped in")
+	}
+	for id, want := range map[string]bool{"test-old": true, "test-late": true, "test-deleted": false} {
+		if got := idx.Exist(id); got != want {
+			t.Errorf("%v indexed = %v after the rebuild, expected %v", id, got, want)
+		}
+	}
+}
+
+func TestFilteredQueryMissingMetadata(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-complete", Title: "Beach Day", Cast: []models.Actor{{Name: "Riley Reid"}}, Tags: []models.Tag{{Name: "pov"}}},
+		{SceneID: "test-no-cast", Title: "Beach Day", Tags: []models.Tag{{Name: "pov"}}},
+		{SceneID: "test-no-tags", Title: "Beach Day", Cast: []models.Actor{{Name: "Riley Reid"}}},
+		{SceneID: "test-empty", Title: "Beach Night"},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		q        string
+		filter   SceneSearchFilter
+		expected []string
+	}{
+		{"missing cast", "", SceneSearchFilter{MissingCast: true}, []string{"test-empty", "test-no-cast"}},
+		{"missing tags", "", SceneSearchFilter{MissingTags: true}, []string{"test-empty", "test-no-tags"}},
+		{"missing both", "", SceneSearchFilter{MissingCast: true, MissingTags: true}, []string{"test-empty"}},
+		{"missing cast with text", "day", SceneSearchFilter{MissingCast: true}, []string{"test-no-cast"}},
+	}
+	for _, tt := range tests {
+		req := bleve.NewSearchRequest(filteredQuery(tt.q, SearchModeQueryString, tt.filter))
+		req.SortBy([]string{"_id"})
+		res, err := idx.Bleve.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s matched %v, expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestSceneDocumentDeduplicatesCast(t *testing.T) {
+	scene := models.Scene{
+		SceneID: "test-duplicate-cast",
+		Cast: []models.Actor{
+			{Name: "Riley Reid", Aliases: `["Paige Riley"]`},
+			{Name: "riley  reid"},
+			{Name: "Riley Steele", Aliases: `["Riley Reid"]`},
+		},
+	}
+
+	doc := sceneDocument(scene)
+	if got := strings.Count(strings.ToLower(doc.Cast), "riley reid"); got != 1 {
+		t.Errorf("cast %q has Riley Reid %v times, expected once", doc.Cast, got)
+	}
+	if expected := []string{"Riley Reid", "Riley Steele"}; !reflect.DeepEqual(doc.CastExact, expected) {
+		t.Errorf("cast_exact = %q, expected %q", doc.CastExact, expected)
+	}
+	if !strings.Contains(doc.Cast, "Paige Riley") {
+		t.Errorf("cast %q is missing the alias Paige Riley", doc.Cast)
+	}
+}
+
+func TestFilteredQueryCastCount(t *testing.T) {
+	idx := newTestIndex(t)
+
+	actors := []models.Actor{{Name: "Riley Reid"}, {Name: "Riley Steele"}, {Name: "Lana Rhoades"}, {Name: "Abella Danger"}}
+	scenes := []models.Scene{
+		{SceneID: "test-solo", Title: "Beach Day", Cast: actors[:1]},
+		{SceneID: "test-couple", Title: "Beach Day", Cast: actors[:2]},
+		{SceneID: "test-group", Title: "Beach Day", Cast: actors},
+		// the same cast member twice is still a solo scene
+		{SceneID: "test-duplicate", Title: "Beach Day", Cast: []models.Actor{actors[0], actors[0]}},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	one, two, three := 1, 2, 3
+	tests := []struct {
+		name     string
+		filter   SceneSearchFilter
+		expected []string
+	}{
+		{"solo", SceneSearchFilter{MinCast: &one, MaxCast: &one}, []string{"test-duplicate", "test-solo"}},
+		{"couple", SceneSearchFilter{MinCast: &two, MaxCast: &two}, []string{"test-couple"}},
+		{"group", SceneSearchFilter{MinCast: &three}, []string{"test-group"}},
+		{"up to two", SceneSearchFilter{MaxCast: &two}, []string{"test-couple", "test-duplicate", "test-solo"}},
+	}
+	for _, tt := range tests {
+		req := bleve.NewSearchRequest(filteredQuery("beach", SearchModeQueryString, tt.filter))
+		req.SortBy([]string{"_id"})
+		res, err := idx.Bleve.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s matched %v, expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestCastSuggestions(t *testing.T) {
+	idx := newTestIndex(t)
+
+	reid := models.Actor{Name: "Riley Reid"}
+	steele := models.Actor{Name: "Riley Steele"}
+	rhoades := models.Actor{Name: "Lana Rhoades"}
+	scenes := []models.Scene{
+		{SceneID: "test-1", Cast: []models.Actor{steele}},
+		{SceneID: "test-2", Cast: []models.Actor{reid, rhoades}},
+		{SceneID: "test-3", Cast: []models.Actor{reid}},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		prefix   string
+		limit    int
+		expected []string
+	}{
+		{"riley", 10, []string{"riley reid", "riley steele"}},
+		{"riley s", 10, []string{"riley steele"}},
+		{"riley", 1, []string{"riley reid"}},
+		{"reid", 10, []string{}},
+	}
+	for _, tt := range tests {
+		got, err := idx.castSuggestions(tt.prefix, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("suggestions for %q = %q, expected %q", tt.prefix, got, tt.expected)
+		}
+	}
+}
+
+func TestCorruptIndexRecovery(t *testing.T) {
+	saved := config.Config.Advanced.SearchIndexAutoRecover
+	t.Cleanup(func() { config.Config.Advanced.SearchIndexAutoRecover = saved })
+
+	corruptIndex := func(t *testing.T) string {
+		path := filepath.Join(t.TempDir(), "scenes")
+		idx, err := newIndexAt(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.PutScene(models.Scene{SceneID: "test-corrupt", Title: "Corrupt"}); err != nil {
+			t.Fatal(err)
+		}
+		idx.Bleve.Close()
+		// a truncated write leaves the index metadata unreadable
+		if err := os.Truncate(filepath.Join(path, "index_meta.json"), 5); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	config.Config.Advanced.SearchIndexAutoRecover = false
+	if _, err := newIndexAt(corruptIndex(t)); err == nil {
+		t.Error("expected an error opening a corrupt index without recovery")
+	}
+
+	config.Config.Advanced.SearchIndexAutoRecover = true
+	path := corruptIndex(t)
+	idx, err := newIndexAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Bleve.Close()
+	if !idx.recovered {
+		t.Error("recovered index not reported")
+	}
+	if count, _ := idx.Bleve.DocCount(); count != 0 {
+		t.Errorf("recovered index has %v documents, expected an empty index", count)
+	}
+	aside, _ := filepath.Glob(path + ".corrupt-*")
+	if len(aside) != 1 {
+		t.Errorf("corrupt index moved to %v, expected one folder", aside)
+	}
+}
+
+func TestNewIndexAt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenes")
+
+	idx, err := newIndexAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.recovered || idx.mappingVersion != sceneMappingVersion {
+		t.Errorf("new index recovered %v with mapping version %v, expected a fresh index with version %v", idx.recovered, idx.mappingVersion, sceneMappingVersion)
+	}
+	if err := idx.PutScene(models.Scene{SceneID: "test-reopen", Title: "Reopen"}); err != nil {
+		t.Fatal(err)
+	}
+	idx.Bleve.Close()
+
+	// an existing index is opened with its documents rather than replaced
+	idx, err = newIndexAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.recovered || !idx.Exist("test-reopen") {
+		t.Errorf("reopened index recovered %v, has document %v, expected the existing index", idx.recovered, idx.Exist("test-reopen"))
+	}
+	idx.Bleve.Close()
+
+	// a folder that cannot be created is an error, not an attempt to open it
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if idx, err := newIndexAt(filepath.Join(file, "scenes")); err == nil {
+		idx.Bleve.Close()
+		t.Error("expected an error creating an index below a file")
+	}
+}
+
+func TestAccentsFolded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenes")
+	idx, err := newIndexAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scene := models.Scene{SceneID: "test-accents", Title: "Renée in Zürich", Cast: []models.Actor{{Name: "Zoé Dupré"}}}
+	if err := idx.PutScene(scene); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, q := range []string{"renee", "title:zurich", "cast:zoe", "dupre", "Renée"} {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(bleve.NewQueryStringQuery(q)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != 1 {
+			t.Errorf("%s matched %v scenes, expected 1", q, res.Total)
+		}
+	}
+	idx.Bleve.Close()
+
+	// indexes built before accents were folded are rebuilt when opened
+	if err := os.WriteFile(indexMetaPath(path), []byte(`{"mapping_version":4}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	idx, err = newIndexAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Bleve.Close()
+	if !idx.MappingOutdated() {
+		t.Error("index built before accents were folded not reported as outdated")
+	}
+}
+
+func TestPathSearch(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-folder", Title: "Beach Day", Files: []models.File{
+			{Path: "/media/vr/anime/2023", Filename: "beach_day.mp4", Type: "video"},
+			{Path: `D:\scripts\favourites`, Filename: "beach_day.funscript", Type: "script"},
+		}},
+		{SceneID: "test-title", Title: "Anime Night", Files: []models.File{{Path: "/media/vr/other", Filename: "night.mp4", Type: "video"}}},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		q        string
+		expected []string
+	}{
+		{"path:anime", []string{"test-folder"}},
+		{"path:favourites", []string{"test-folder"}},
+		{"path:funscript", []string{"test-folder"}},
+		{"path:vr", []string{"test-folder", "test-title"}},
+		// folder names are not matched by a plain search
+		{"anime", []string{"test-title"}},
+	}
+	for _, tt := range tests {
+		req := bleve.NewSearchRequest(bleve.NewQueryStringQuery(tt.q))
+		req.SortBy([]string{"_id"})
+		res, err := idx.Bleve.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s matched %v, expected %v", tt.q, got, tt.expected)
+		}
+	}
+}
+
+func TestFieldBoosts(t *testing.T) {
+	idx := newTestIndex(t)
+
+	// the description only scene has the word twice, so it would rank first if every field counted the same
+	scenes := []models.Scene{
+		{SceneID: "test-title", Title: "Lighthouse Keeper"},
+		{SceneID: "test-description", Title: "Keeper", Synopsis: "A lighthouse by the lighthouse"},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved := config.Config.Advanced.SearchFieldBoosts
+	t.Cleanup(func() { config.Config.Advanced.SearchFieldBoosts = saved })
+	config.Config.Advanced.SearchFieldBoosts = config.SearchFieldBoosts{Title: 4, Cast: 3, Tags: 2, Description: 1}
+
+	for _, q := range []string{"lighthouse", "+lighthouse -site:none"} {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(textQuery(q, SearchModeQueryString)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != 2 {
+			t.Fatalf("%v matched %v scenes, expected 2", q, res.Total)
+		}
+		if got := res.Hits[0].ID; got != "test-title" {
+			t.Errorf("%v ranked %v first, expected the title match", q, got)
+		}
+	}
+
+	if got := unfieldedWords(`+lighthouse cast:"riley reid" -tags:pov "keeper"`); got != "lighthouse keeper" {
+		t.Errorf("unfielded words %q, expected lighthouse keeper", got)
+	}
+}
+
+func TestSiteBoosts(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-normal", Title: "Beach Day", Site: "Normal Site"},
+		{SceneID: "test-boosted", Title: "Beach Day", Site: "Boosted Site"},
+		{SceneID: "test-other", Title: "Forest Day", Site: "Boosted Site"},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved := config.Config.Advanced.SearchSiteBoosts
+	t.Cleanup(func() { config.Config.Advanced.SearchSiteBoosts = saved })
+	run := func(boosts map[string]float64) []*search.DocumentMatch {
+		config.Config.Advanced.SearchSiteBoosts = boosts
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(textQuery("beach", SearchModeQueryString)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != 2 {
+			t.Fatalf("beach matched %v scenes, expected 2", res.Total)
+		}
+		return res.Hits
+	}
+
+	for _, boosts := range []map[string]float64{nil, {"Normal Site": 1, "Boosted Site": 1}} {
+		if hits := run(boosts); hits[0].Score != hits[1].Score {
+			t.Errorf("boosts %v scored %v and %v, expected the same score", boosts, hits[0].Score, hits[1].Score)
+		}
+	}
+	hits := run(map[string]float64{"Normal Site": 1, "Boosted Site": 2})
+	if hits[0].ID != "test-boosted" || hits[0].Score <= hits[1].Score {
+		t.Errorf("ranked %v (%v) above %v (%v), expected the boosted site first", hits[0].ID, hits[0].Score, hits[1].ID, hits[1].Score)
+	}
+}
+
+func TestFilteredQuerySceneIDs(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-one", Title: "Beach Day"},
+		{SceneID: "test-two", Title: "Beach Night"},
+		{SceneID: "test-three", Title: "Beach Morning"},
+		{SceneID: "test-four", Title: "Forest Day"},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(q string, ids []string) []string {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(filteredQuery(q, SearchModeQueryString, SceneSearchFilter{SceneIDs: ids})))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	within := []string{"test-one", "test-two", "test-four"}
+	if got := search("beach", within); !reflect.DeepEqual(got, []string{"test-one", "test-two"}) {
+		t.Errorf("beach within %v matched %v, expected test-one and test-two", within, got)
+	}
+	if got := search("", within); !reflect.DeepEqual(got, []string{"test-four", "test-one", "test-two"}) {
+		t.Errorf("an empty search within %v matched %v, expected all of them", within, got)
+	}
+	if got := search("beach", []string{}); got != nil {
+		t.Errorf("beach within no scenes matched %v, expected none", got)
+	}
+}
+
+func TestTotalDuration(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-long", Title: "Beach Day", Duration: 60},
+		{SceneID: "test-short", Title: "Beach Night", Duration: 45},
+		{SceneID: "test-unknown", Title: "Beach Morning"},
+		{SceneID: "test-other", Title: "Forest Day", Duration: 30},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := idx.totalDuration(bleve.NewQueryStringQuery("beach"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 105 {
+		t.Errorf("total duration of beach = %v, expected 105", got)
+	}
+}
+
+func TestVerifyAndCompactIndex(t *testing.T) {
+	idx := newTestIndex(t)
+
+	// replacing documents leaves the old versions in the segments until they are merged
+	for round := 0; round < 3; round++ {
+		for n := 0; n < 100; n++ {
+			if err := idx.PutScene(models.Scene{SceneID: fmt.Sprintf("test-%v", n), Title: fmt.Sprintf("Beach %v %v", n, round)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if count, err := idx.verify(); err != nil || count != 100 {
+		t.Fatalf("verify counted %v documents with error %v, expected 100", count, err)
+	}
+
+	path := idx.Bleve.Name()
+	before := settledDirSize(path, 5*time.Second)
+	if err := idx.compact(); err != nil {
+		t.Fatal(err)
+	}
+	if after := settledDirSize(path, 5*time.Second); after > before {
+		t.Errorf("index grew from %v to %v bytes when compacted", before, after)
+	}
+	if count, err := idx.verify(); err != nil || count != 100 {
+		t.Errorf("verify after compaction counted %v documents with error %v, expected 100", count, err)
+	}
+	if !idx.Exist("test-42") {
+		t.Error("a document is missing after compaction")
+	}
+}
+
+func TestFilteredQueryScripted(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-scripted", Title: "Beach Day", IsScripted: true},
+		{SceneID: "test-unscripted", Title: "Beach Night"},
+		{SceneID: "test-other", Title: "Forest Day", IsScripted: true},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(q string, filter SceneSearchFilter) []string {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(filteredQuery(q, SearchModeQueryString, filter)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	scripted, unscripted := true, false
+	if got := search("beach", SceneSearchFilter{Scripted: &scripted}); !reflect.DeepEqual(got, []string{"test-scripted"}) {
+		t.Errorf("scripted beach scenes %v, expected test-scripted", got)
+	}
+	if got := search("beach", SceneSearchFilter{Scripted: &unscripted}); !reflect.DeepEqual(got, []string{"test-unscripted"}) {
+		t.Errorf("unscripted beach scenes %v, expected test-unscripted", got)
+	}
+	if got := search("scripted:true", SceneSearchFilter{}); !reflect.DeepEqual(got, []string{"test-other", "test-scripted"}) {
+		t.Errorf("scripted:true matched %v, expected every scripted scene", got)
+	}
+}
+
+func TestFilteredQueryGallery(t *testing.T) {
+	idx := newTestIndex(t)
+
+	gallery := `[{"url":"https://example.com/cover.jpg","type":"cover"},{"url":"https://example.com/1.jpg","type":"gallery"},{"url":"https://example.com/2.jpg","type":"gallery"}]`
+	scenes := []models.Scene{
+		{SceneID: "test-gallery", Title: "Beach Day", Images: gallery},
+		{SceneID: "test-cover", Title: "Beach Night", Images: `[{"url":"https://example.com/cover.jpg","type":"cover"}]`},
+		{SceneID: "test-none", Title: "Beach Morning"},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stored, err := idx.storedScene("test-gallery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ImageCount != 2 {
+		t.Errorf("image count %v, expected the 2 gallery images without the cover", stored.ImageCount)
+	}
+
+	search := func(q string, filter SceneSearchFilter) []string {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(filteredQuery(q, SearchModeQueryString, filter)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	withGallery, withoutGallery := true, false
+	if got := search("beach", SceneSearchFilter{HasGallery: &withGallery}); !reflect.DeepEqual(got, []string{"test-gallery"}) {
+		t.Errorf("beach scenes with a gallery %v, expected test-gallery", got)
+	}
+	if got := search("beach", SceneSearchFilter{HasGallery: &withoutGallery}); !reflect.DeepEqual(got, []string{"test-cover", "test-none"}) {
+		t.Errorf("beach scenes without a gallery %v, expected test-cover and test-none", got)
+	}
+	if got := search("beach gallery:false", SceneSearchFilter{}); !reflect.DeepEqual(got, []string{"test-cover", "test-none"}) {
+		t.Errorf("gallery:false matched %v, expected test-cover and test-none", got)
+	}
+}
+
+func TestFilteredQueryFavouriteOnly(t *testing.T) {
+	idx := newTestIndex(t)
+
+	for _, scene := range []models.Scene{
+		{SceneID: "test-favourite", Title: "Beach Day", Favourite: true},
+		{SceneID: "test-other", Title: "Beach Night"},
+		{SceneID: "test-wishlist", Title: "Beach Morning", Wishlist: true},
+	} {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(q string, filter SceneSearchFilter) []string {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(filteredQuery(q, SearchModeQueryString, filter)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		return got
+	}
+
+	if got := search("beach", SceneSearchFilter{FavouriteOnly: true}); !reflect.DeepEqual(got, []string{"test-favourite"}) {
+		t.Errorf("favourite beach scenes %v, expected test-favourite", got)
+	}
+	if got := search("", SceneSearchFilter{FavouriteOnly: true}); !reflect.DeepEqual(got, []string{"test-favourite"}) {
+		t.Errorf("favourite scenes %v, expected test-favourite", got)
+	}
+	if got := search("beach", SceneSearchFilter{WishlistOnly: true}); !reflect.DeepEqual(got, []string{"test-wishlist"}) {
+		t.Errorf("wishlist beach scenes %v, expected test-wishlist", got)
+	}
+}
+
+func TestFilteredQueryAddedWithin(t *testing.T) {
+	idx := newTestIndex(t)
+
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	scenes := []models.Scene{
+		{SceneID: "test-today", Title: "Beach Day", CreatedAt: time.Date(2024, 6, 15, 9, 0, 0, 0, time.UTC)},
+		{SceneID: "test-first-day", Title: "Beach Night", CreatedAt: time.Date(2024, 6, 8, 1, 0, 0, 0, time.UTC)},
+		{SceneID: "test-day-before", Title: "Beach Morning", CreatedAt: time.Date(2024, 6, 7, 23, 0, 0, 0, time.UTC)},
+		{SceneID: "test-last-month", Title: "Beach Evening", CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{SceneID: "test-forest", Title: "Forest Day", CreatedAt: time.Date(2024, 6, 14, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(q string) []string {
+		added := addedWithin(7, now)
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(filteredQuery(q, SearchModeQueryString, SceneSearchFilter{Added: &added})))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	if got := search("beach"); !reflect.DeepEqual(got, []string{"test-first-day", "test-today"}) {
+		t.Errorf("beach scenes added in the last 7 days %v, expected test-first-day and test-today", got)
+	}
+	if got := search(""); !reflect.DeepEqual(got, []string{"test-first-day", "test-forest", "test-today"}) {
+		t.Errorf("scenes added in the last 7 days %v, expected test-first-day, test-forest and test-today", got)
+	}
+}
+
+func TestOriginalTitle(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-translated", Title: "A Day at the Beach", OriginalTitle: "ビーチで過ごす一日"},
+		{SceneID: "test-english", Title: "Beach Night"},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(q string) []string {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(filteredQuery(q, SearchModeQueryString, SceneSearchFilter{})))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	tests := []struct {
+		q        string
+		expected []string
+	}{
+		{"day", []string{"test-translated"}},
+		{"ビーチ", []string{"test-translated"}},
+		{"一日", []string{"test-translated"}},
+		{"original_title:一日", []string{"test-translated"}},
+		{"original_title:beach", nil},
+	}
+	for _, tt := range tests {
+		if got := search(tt.q); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q matched %v, expected %v", tt.q, got, tt.expected)
+		}
+	}
+}
+
+func TestContentFilter(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-pov", Title: "Beach Day", Site: "VR Bangers", Tags: []models.Tag{{Name: "pov"}}},
+		{SceneID: "test-blocked", Title: "Beach Night", Site: "VR Bangers", Tags: []models.Tag{{Name: "pov"}, {Name: "extreme"}}},
+		{SceneID: "test-other-site", Title: "Beach Morning", Site: "Czech VR", Tags: []models.Tag{{Name: "outdoor"}}},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(filter SceneContentFilter) ([]string, uint64) {
+		req := bleve.NewSearchRequest(filter.restrict(filteredQuery("beach", SearchModeQueryString, SceneSearchFilter{})))
+		req.Size = 1
+		res, err := idx.Bleve.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Size = 10
+		all, err := idx.Bleve.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range all.Hits {
+			got = append(got, hit.ID)
+		}
+		sort.Strings(got)
+		return got, res.Total
+	}
+
+	tests := []struct {
+		name     string
+		filter   SceneContentFilter
+		expected []string
+	}{
+		{"user without a filter", SceneContentFilter{}, []string{"test-blocked", "test-other-site", "test-pov"}},
+		{"user blocking a tag", SceneContentFilter{BlockedTags: []string{"extreme"}}, []string{"test-other-site", "test-pov"}},
+		{"allowed tag", SceneContentFilter{AllowedTags: []string{"pov"}, BlockedTags: []string{"extreme"}}, []string{"test-pov"}},
+		{"allowed site", SceneContentFilter{AllowedSites: []string{"Czech VR"}}, []string{"test-other-site"}},
+		{"blocked site", SceneContentFilter{BlockedSites: []string{"VR Bangers"}}, []string{"test-other-site"}},
+	}
+	for _, tt := range tests {
+		got, total := search(tt.filter)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%v matched %v, expected %v", tt.name, got, tt.expected)
+		}
+		// counted at query time, so a page of one still reports every visible match
+		if total != uint64(len(tt.expected)) {
+			t.Errorf("%v total %v, expected %v", tt.name, total, len(tt.expected))
+		}
+	}
+}
+
+func TestDropWeakHits(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-strong", Title: "Beach Beach Beach"},
+		{SceneID: "test-weak", Title: "Forest Day", Synopsis: "A long walk through the forest that ends somewhere near a beach for a while"},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func() *bleve.SearchResult {
+		req := bleve.NewSearchRequest(filteredQuery("beach", SearchModeQueryString, SceneSearchFilter{}))
+		req.SortBy(sceneSortOrder(idx.Bleve.Mapping(), nil))
+		res, err := idx.Bleve.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := search()
+	if len(res.Hits) != 2 || res.Hits[0].ID != "test-strong" {
+		t.Fatalf("hits %v, expected test-strong ahead of test-weak", res.Hits)
+	}
+	threshold := (res.Hits[0].Score + res.Hits[1].Score) / 2
+
+	dropWeakHits(res, threshold, 0, true)
+	if len(res.Hits) != 1 || res.Hits[0].ID != "test-strong" || res.Total != 1 {
+		t.Errorf("hits %v of %v, expected only test-strong", res.Hits, res.Total)
+	}
+
+	// a threshold of 0 keeps every match
+	res = search()
+	dropWeakHits(res, 0, 0, true)
+	if len(res.Hits) != 2 || res.Total != 2 {
+		t.Errorf("hits %v of %v, expected both scenes", res.Hits, res.Total)
+	}
+}
+
+func TestSearchByFileSize(t *testing.T) {
+	idx := newTestIndex(t)
+
+	gb := int64(1 << 30)
+	scenes := []models.Scene{
+		{SceneID: "test-small", Title: "Beach Day", Files: []models.File{{Type: "video", Size: gb}}},
+		{SceneID: "test-large", Title: "Beach Night", Files: []models.File{{Type: "video", Size: 6 * gb}, {Type: "script", Size: 1000}}},
+		{SceneID: "test-medium", Title: "Beach Morning", Files: []models.File{{Type: "video", Size: 2 * gb}, {Type: "video", Size: 2 * gb}}},
+		{SceneID: "test-no-files", Title: "Beach Evening"},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(filter SceneSearchFilter) []string {
+		req := bleve.NewSearchRequest(filteredQuery("beach", SearchModeQueryString, filter))
+		req.SortBy(sceneSortOrder(idx.Bleve.Mapping(), []string{"-size"}))
+		res, err := idx.Bleve.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		return got
+	}
+
+	if got := search(SceneSearchFilter{}); !reflect.DeepEqual(got, []string{"test-large", "test-medium", "test-small", "test-no-files"}) {
+		t.Errorf("beach scenes by size %v, expected the largest first", got)
+	}
+	min := 3 * gb
+	if got := search(SceneSearchFilter{MinFileSize: &min}); !reflect.DeepEqual(got, []string{"test-large", "test-medium"}) {
+		t.Errorf("beach scenes of at least 3GB %v, expected test-large and test-medium", got)
+	}
+
+	stored, err := idx.storedScene("test-large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.FileSize != 6*gb+1000 {
+		t.Errorf("stored size %v, expected the video and script added up", stored.FileSize)
+	}
+}
+
+func TestTagGroupsQuery(t *testing.T) {
+	idx := newTestIndex(t)
+
+	tags := func(names ...string) []models.Tag {
+		var tags []models.Tag
+		for _, name := range names {
+			tags = append(tags, models.Tag{Name: name})
+		}
+		return tags
+	}
+	scenes := []models.Scene{
+		{SceneID: "test-pov-blonde", Title: "Beach Day", Tags: tags("pov", "blonde")},
+		{SceneID: "test-solo-blonde", Title: "Beach Night", Tags: tags("solo", "blonde", "big tits")},
+		{SceneID: "test-pov-brunette", Title: "Forest Day", Tags: tags("pov", "brunette")},
+		{SceneID: "test-blonde", Title: "Forest Night", Tags: tags("blonde")},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(groups []TagGroup) []string {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(tagGroupsQuery(groups)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	tests := []struct {
+		name     string
+		groups   []TagGroup
+		expected []string
+	}{
+		{"(pov or solo) and blonde", []TagGroup{
+			{Tags: []string{"pov", "solo"}, Operator: TagOperatorOr},
+			{Tags: []string{"blonde"}},
+		}, []string{"test-pov-blonde", "test-solo-blonde"}},
+		{"pov or solo", []TagGroup{{Tags: []string{"pov", "solo"}, Operator: TagOperatorOr}}, []string{"test-pov-blonde", "test-pov-brunette", "test-solo-blonde"}},
+		{"pov and blonde", []TagGroup{{Tags: []string{"pov", "blonde"}, Operator: TagOperatorAnd}}, []string{"test-pov-blonde"}},
+		{"a tag of several words", []TagGroup{{Tags: []string{"big tits"}}}, []string{"test-solo-blonde"}},
+		{"no tags", []TagGroup{{Tags: []string{" "}, Operator: TagOperatorOr}}, nil},
+	}
+	for _, tt := range tests {
+		if got := search(tt.groups); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%v matched %v, expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestMatchedFields(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-cast", Title: "Beach Day", Cast: []models.Actor{{Name: "Riley Reid"}}},
+		{SceneID: "test-title", Title: "Riley at the Beach", Synopsis: "A day at the beach"},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved := config.Config.Advanced.SearchFieldBoosts
+	t.Cleanup(func() { config.Config.Advanced.SearchFieldBoosts = saved })
+	config.Config.Advanced.SearchFieldBoosts = config.SearchFieldBoosts{Title: 4, Cast: 3, Tags: 2, Description: 1}
+
+	matched := func(q string, opts SceneSearchOptions) map[string][]string {
+		res, err := idx.Bleve.Search(newSceneSearchRequest(idx.Bleve.Mapping(), textQuery(q, SearchModeQueryString), opts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields := map[string][]string{}
+		for _, hit := range res.Hits {
+			fields[hit.ID] = matchedFields(hit)
+		}
+		return fields
+	}
+
+	got := matched("reid", SceneSearchOptions{MatchedFields: true})
+	if !reflect.DeepEqual(got["test-cast"], []string{"cast"}) {
+		t.Errorf("reid matched test-cast in %v, expected cast", got["test-cast"])
+	}
+	got = matched("beach", SceneSearchOptions{MatchedFields: true})
+	if !reflect.DeepEqual(got["test-title"], []string{"description", "title"}) {
+		t.Errorf("beach matched test-title in %v, expected description and title", got["test-title"])
+	}
+	if got := matched("reid", SceneSearchOptions{}); got["test-cast"] != nil {
+		t.Errorf("matched fields %v returned without being requested", got["test-cast"])
+	}
+}
+
+func TestFilteredQuerySites(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-bangers", Title: "Beach Day", Site: "VR Bangers"},
+		{SceneID: "test-hush", Title: "Beach Night", Site: "VR Hush"},
+		{SceneID: "test-conk", Title: "Beach Morning", Site: "VRConk"},
+		{SceneID: "test-naughty", Title: "Beach Evening", Site: "Naughty America"},
+		{SceneID: "test-forest", Title: "Forest Day", Site: "VR Bangers"},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(q string, sites []string) []string {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(filteredQuery(q, SearchModeQueryString, SceneSearchFilter{Sites: sites})))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	// VR alone is not a site, only full names match
+	if got := search("beach", []string{"VR Bangers", "VRConk"}); !reflect.DeepEqual(got, []string{"test-bangers", "test-conk"}) {
+		t.Errorf("beach on two sites matched %v, expected test-bangers and test-conk", got)
+	}
+	if got := search("beach", []string{"VR Bangers", "VR Hush", "Naughty America"}); !reflect.DeepEqual(got, []string{"test-bangers", "test-hush", "test-naughty"}) {
+		t.Errorf("beach on three sites matched %v, expected test-bangers, test-hush and test-naughty", got)
+	}
+	if got := search("", []string{"VR Bangers", "VR"}); !reflect.DeepEqual(got, []string{"test-bangers", "test-forest"}) {
+		t.Errorf("every scene of VR Bangers and VR matched %v, expected test-bangers and test-forest", got)
+	}
+}
+
+func TestReleaseYear(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-2020", Title: "Beach Day", ReleaseDate: time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{SceneID: "test-2022a", Title: "Beach Night", ReleaseDate: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{SceneID: "test-2022b", Title: "Beach Morning", ReleaseDate: time.Date(2022, 6, 15, 0, 0, 0, 0, time.UTC)},
+		{SceneID: "test-2023", Title: "Forest Day", ReleaseDate: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{SceneID: "test-undated", Title: "Beach Evening"},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if si := sceneDocument(scenes[4]); si.Year != nil {
+		t.Errorf("scene without a release date indexed with year %v", *si.Year)
+	}
+
+	search := func(q string) []string {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(filteredQuery(q, SearchModeQueryString, SceneSearchFilter{})))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		sort.Strings(got)
+		return got
+	}
+	if got := search("year:2022"); !reflect.DeepEqual(got, []string{"test-2022a", "test-2022b"}) {
+		t.Errorf("year:2022 matched %v, expected test-2022a and test-2022b", got)
+	}
+	if got := search("beach year:2020"); !reflect.DeepEqual(got, []string{"test-2020"}) {
+		t.Errorf("beach year:2020 matched %v, expected test-2020", got)
+	}
+	if got := search("year:2021"); got != nil {
+		t.Errorf("year:2021 matched %v, expected none", got)
+	}
+
+	req := bleve.NewSearchRequest(bleve.NewMatchAllQuery())
+	req.AddFacet("year", yearFacetRequest(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+	res, err := idx.Bleve.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for _, r := range res.Facets["year"].NumericRanges {
+		counts[r.Name] = r.Count
+	}
+	if expected := map[string]int{"2020": 1, "2022": 2, "2023": 1}; !reflect.DeepEqual(counts, expected) {
+		t.Errorf("year facet %v, expected %v", counts, expected)
+	}
+}
+
+func TestFilteredQueryRating(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-five", Title: "Beach Day", StarRating: 5},
+		{SceneID: "test-four", Title: "Beach Night", StarRating: 4},
+		{SceneID: "test-half", Title: "Beach Morning", StarRating: 3.5},
+		{SceneID: "test-unrated", Title: "Beach Evening"},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(q string, filter SceneSearchFilter) []string {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(filteredQuery(q, SearchModeQueryString, filter)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		sort.Strings(got)
+		return got
+	}
+	four := 4.0
+	if got := search("beach", SceneSearchFilter{MinRating: &four}); !reflect.DeepEqual(got, []string{"test-five", "test-four"}) {
+		t.Errorf("beach with a min rating of 4 matched %v, expected test-five and test-four", got)
+	}
+	for _, q := range []string{"beach rating>=4", "rating:>=4 beach", "rating>=4"} {
+		if got := search(q, SceneSearchFilter{}); !reflect.DeepEqual(got, []string{"test-five", "test-four"}) {
+			t.Errorf("%q matched %v, expected test-five and test-four", q, got)
+		}
+	}
+	if got := search("beach rating>=3.5", SceneSearchFilter{}); !reflect.DeepEqual(got, []string{"test-five", "test-four", "test-half"}) {
+		t.Errorf("beach rating>=3.5 matched %v, expected the three rated scenes", got)
+	}
+
+	req := bleve.NewSearchRequest(bleve.NewMatchQuery("beach"))
+	req.SortBy(sceneSortOrder(idx.Bleve.Mapping(), []string{"rating"}))
+	res, err := idx.Bleve.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, hit := range res.Hits {
+		got = append(got, hit.ID)
+	}
+	if expected := []string{"test-five", "test-four", "test-half", "test-unrated"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("sorted by rating %v, expected %v", got, expected)
+	}
+}
+
+func TestEmptySearch(t *testing.T) {
+	idx := newTestIndex(t)
+
+	now := time.Now()
+	scenes := []models.Scene{
+		{SceneID: "test-old", Title: "Beach Day", CreatedAt: now.AddDate(0, -2, 0)},
+		{SceneID: "test-new", Title: "Beach Night", CreatedAt: now.Add(-time.Hour)},
+		{SceneID: "test-middle", Title: "Forest Day", CreatedAt: now.AddDate(0, -1, 0)},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// without asking for recent scenes no scenes are searched for, so the db is never opened
+	for _, q := range []string{"", "   ", "\t\n"} {
+		result, err := FuzzySearchScenesWithOptions(q, SceneSearchOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Scenes == nil || len(result.Scenes) != 0 || result.Total != 0 {
+			t.Errorf("search for %q returned %+v, expected an empty list of scenes", q, result)
+		}
+	}
+
+	for _, sortBy := range [][]string{nil, {"relevance"}} {
+		opts := recentSceneOptions(SceneSearchOptions{RecentWhenEmpty: true, SortBy: sortBy})
+		res, err := idx.Bleve.Search(newSceneSearchRequest(idx.Bleve.Mapping(), bleve.NewMatchAllQuery(), opts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		if expected := []string{"test-new", "test-middle", "test-old"}; !reflect.DeepEqual(got, expected) {
+			t.Errorf("recent scenes sorted by %v are %v, expected %v", sortBy, got, expected)
+		}
+	}
+	if opts := recentSceneOptions(SceneSearchOptions{SortBy: []string{"longest"}}); !reflect.DeepEqual(opts.SortBy, []string{"longest"}) {
+		t.Errorf("recent scenes sorted by %v, expected the requested longest order", opts.SortBy)
+	}
+}
+
+func TestCurrentDocuments(t *testing.T) {
+	idx := newTestIndex(t)
+
+	saved := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	unchanged := models.Scene{SceneID: "test-unchanged", Title: "Beach Day", UpdatedAt: saved}
+	modified := models.Scene{SceneID: "test-modified", Title: "Beach Night", UpdatedAt: saved}
+	for _, scene := range []models.Scene{unchanged, modified} {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	modified.Title = "Forest Night"
+	modified.UpdatedAt = saved.Add(time.Second)
+	if !idx.Current(unchanged) {
+		t.Error("unchanged scene reported as outdated")
+	}
+	if idx.Current(modified) {
+		t.Error("modified scene reported as current")
+	}
+	if idx.Current(models.Scene{SceneID: "test-missing"}) {
+		t.Error("scene without a document reported as current")
+	}
+
+	// an incremental run skips current documents, as SearchIndex does
+	var indexed []string
+	var mu sync.Mutex
+	batcher := newSceneBatcher(idx, 10)
+	queue := make(chan models.Scene)
+	wg := indexSceneWorkers(batcher, 2, queue, func(scene models.Scene) bool {
+		if idx.Current(scene) {
+			return true
+		}
+		mu.Lock()
+		indexed = append(indexed, scene.SceneID)
+		mu.Unlock()
+		return false
+	})
+	queue <- unchanged
+	queue <- modified
+	close(queue)
+	wg.Wait()
+	if err := batcher.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(indexed, []string{"test-modified"}) {
+		t.Errorf("reindexed %v, expected only test-modified", indexed)
+	}
+	si, err := idx.storedScene("test-modified")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if si.Title != "Forest Night" || si.UpdatedAt != modified.UpdatedAt.UnixMilli() {
+		t.Errorf("modified scene stored as %q updated at %v, expected the new title and time", si.Title, si.UpdatedAt)
+	}
+}
+
+func TestAllWordsAcrossFields(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-both", Title: "Beach Day", Cast: []models.Actor{{Name: "Riley Reid"}}, Tags: []models.Tag{{Name: "pov"}}},
+		{SceneID: "test-cast", Title: "Beach Night", Cast: []models.Actor{{Name: "Riley Reid"}}, Tags: []models.Tag{{Name: "outdoor"}}},
+		{SceneID: "test-tags", Title: "Forest Day", Tags: []models.Tag{{Name: "pov"}}},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved := config.Config.Web.SearchMatchAnyWord
+	t.Cleanup(func() { config.Config.Web.SearchMatchAnyWord = saved })
+
+	search := func(q string) []string {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(textQuery(q, SearchModeQueryString)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	config.Config.Web.SearchMatchAnyWord = false
+	for q, expected := range map[string][]string{
+		"riley pov":           {"test-both"},
+		"beach riley":         {"test-both", "test-cast"},
+		`"riley reid" -pov`:   {"test-cast"},
+		"riley tags:pov":      {"test-both"},
+		"riley pov nowhere":   nil,
+		"+riley beach -night": {"test-both"},
+	} {
+		if got := search(q); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%v matched %v, expected %v", q, got, expected)
+		}
+	}
+
+	config.Config.Web.SearchMatchAnyWord = true
+	if got := search("riley pov"); !reflect.DeepEqual(got, []string{"test-both", "test-cast", "test-tags"}) {
+		t.Errorf("riley pov matching any word matched %v, expected every scene", got)
+	}
+}
+
+func TestReindexerCoalesces(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]string
+	r := newReindexer(50*time.Millisecond, func(sceneIDs []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, append([]string(nil), sceneIDs...))
+	})
+	written := func() [][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return batches
+	}
+
+	for _, id := range []string{"test-1", "test-2", "test-1", "test-3", "test-2"} {
+		r.queue(id)
+	}
+	if got := written(); got != nil {
+		t.Fatalf("written before the delay: %v", got)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if got, expected := written(), [][]string{{"test-1", "test-2", "test-3"}}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("wrote %v, expected %v", got, expected)
+	}
+
+	// a flush writes straight away, and leaves nothing for the timer
+	r.queue("test-4")
+	r.flush()
+	if got := written(); len(got) != 2 || !reflect.DeepEqual(got[1], []string{"test-4"}) {
+		t.Fatalf("flush wrote %v, expected test-4 in a second batch", got)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := written(); len(got) != 2 {
+		t.Errorf("timer wrote again after a flush: %v", got)
+	}
+	r.flush()
+	if got := written(); len(got) != 2 {
+		t.Errorf("flushing an empty queue wrote %v", got)
+	}
+}
+
+func TestSearchTieBreakers(t *testing.T) {
+	idx := newTestIndex(t)
+
+	released := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	// added in an order that differs from the expected one, the three match beach with the same score
+	scenes := []models.Scene{
+		{SceneID: "test-b", Title: "Beach Day", ReleaseDate: released},
+		{SceneID: "test-older", Title: "Beach Day", ReleaseDate: released.AddDate(-1, 0, 0)},
+		{SceneID: "test-a", Title: "Beach Day", ReleaseDate: released},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page := func(offset int, size int) []string {
+		req := newSceneSearchRequest(idx.Bleve.Mapping(), textQuery("beach", SearchModeQueryString), SceneSearchOptions{Offset: offset, Size: size})
+		res, err := idx.Bleve.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		return got
+	}
+
+	expected := []string{"test-a", "test-b", "test-older"}
+	for i := 0; i < 5; i++ {
+		if got := page(0, 10); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("run %v ordered %v, expected %v", i, got, expected)
+		}
+	}
+	var paged []string
+	for offset := 0; offset < len(expected); offset++ {
+		paged = append(paged, page(offset, 1)...)
+	}
+	if !reflect.DeepEqual(paged, expected) {
+		t.Errorf("pages of one returned %v, expected %v", paged, expected)
+	}
+
+	if got := sceneSortOrder(idx.Bleve.Mapping(), []string{"-added", "-_id"}); !reflect.DeepEqual(got, []string{"-added_at", "-_id"}) {
+		t.Errorf("sort ending with the id got tie breakers %v", got)
+	}
+	if got := sceneSortOrder(idx.Bleve.Mapping(), []string{"newest"}); !reflect.DeepEqual(got, []string{"-released", "-_score", "_id"}) {
+		t.Errorf("newest sorted by %v, expected -released, -_score, _id", got)
+	}
+}
+
+func TestScoredScenes(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-one", Title: "Beach Day", Synopsis: "A walk on the beach"},
+		{SceneID: "test-both", Title: "Beach Day Sunset", Synopsis: "Sunset on the beach"},
+		{SceneID: "test-other", Title: "Forest Day"},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := idx.Bleve.Search(newSceneSearchRequest(idx.Bleve.Mapping(), textQuery("beach", SearchModeQueryString), SceneSearchOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the scenes as ScenesFromSearchResult would load them, without the db
+	var hits []models.Scene
+	for _, hit := range res.Hits {
+		hits = append(hits, models.Scene{SceneID: hit.ID, Score: hit.Score})
+	}
+
+	scored, max := scoredScenes(hits)
+	if len(scored) != 2 {
+		t.Fatalf("got %v scored scenes, expected 2", len(scored))
+	}
+	if max != scored[0].Score {
+		t.Errorf("best match scored %v with a max of %v, expected the max score", scored[0].Score, max)
+	}
+	for i, s := range scored {
+		if s.Score <= 0 {
+			t.Errorf("%v has no score", s.Scene.SceneID)
+		}
+		if i > 0 && s.Score > scored[i-1].Score {
+			t.Errorf("%v scored %v above %v before it", s.Scene.SceneID, s.Score, scored[i-1].Score)
+		}
+	}
+}
+
+func TestDescriptionLengthCap(t *testing.T) {
+	saved := config.Config.Advanced.SearchDescriptionMaxLength
+	t.Cleanup(func() { config.Config.Advanced.SearchDescriptionMaxLength = saved })
+	config.Config.Advanced.SearchDescriptionMaxLength = 2000
+
+	idx := newTestIndex(t)
+
+	synopsis := "Lighthouse keeper story. " + strings.Repeat("transcript words ", 500) + "epilogue"
+	scene := models.Scene{SceneID: "test-long", Title: "Keeper", Synopsis: synopsis}
+	if err := idx.PutScene(scene); err != nil {
+		t.Fatal(err)
+	}
+
+	si, err := idx.storedScene("test-long")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len([]rune(si.Description)); n > 2000 || n < 1950 {
+		t.Errorf("indexed %v characters of the synopsis, expected up to 2000", n)
+	}
+	if !strings.HasPrefix(synopsis, si.Description) || !strings.HasSuffix(si.Description, "words") {
+		t.Errorf("indexed description %q... is not the synopsis cut after a whole word", si.Description[len(si.Description)-20:])
+	}
+	if scene.Synopsis != synopsis {
+		t.Errorf("the scene synopsis was changed")
+	}
+
+	for q, expected := range map[string]uint64{"lighthouse": 1, "description:lighthouse": 1, "epilogue": 0} {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(textQuery(q, SearchModeQueryString)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != expected {
+			t.Errorf("%v matched %v scenes, expected %v", q, res.Total, expected)
+		}
+	}
+
+	for _, tt := range []struct {
+		s        string
+		max      int
+		expected string
+	}{
+		{"short", 10, "short"},
+		{"one two three", 9, "one two"},
+		{"one two three", 8, "one two"},
+		{"one two three", 7, "one two"},
+		{"unbroken", 4, "unbr"},
+		{"één twee", 5, "één"},
+		{"one two", 0, "one two"},
+	} {
+		if got := truncateOnWord(tt.s, tt.max); got != tt.expected {
+			t.Errorf("truncateOnWord(%q, %v) = %q, expected %q", tt.s, tt.max, got, tt.expected)
+		}
+	}
+}
+
+func TestExcludedSites(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-kept", Title: "Beach Day", Site: "Kept Site"},
+		{SceneID: "test-trial", Title: "Beach Day", Site: "Trial Site"},
+		{SceneID: "test-trial-2", Title: "Beach Night Trial Site", Site: "Trial Site"},
+	}
+	for _, scene := range scenes {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(q query.Query) []string {
+		res, err := idx.Bleve.Search(bleve.NewSearchRequest(q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, hit := range res.Hits {
+			got = append(got, hit.ID)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	excluded := []string{"Trial Site"}
+	for _, q := range []string{"beach", `+site:"trial site"`, "trial", "beach night"} {
+		for _, mode := range []SearchMode{SearchModeQueryString, SearchModeMatch, SearchModePrefix} {
+			got := search(withoutSites(filteredQuery(q, mode, SceneSearchFilter{}), excluded))
+			for _, id := range got {
+				if id != "test-kept" {
+					t.Errorf("%v in %v mode matched %v from an excluded site", q, mode, id)
+				}
+			}
+		}
+	}
+	if got := search(withoutSites(textQuery("beach", SearchModeQueryString), excluded)); !reflect.DeepEqual(got, []string{"test-kept"}) {
+		t.Errorf("beach matched %v without the excluded site, expected test-kept", got)
+	}
+	if got := search(withoutSites(bleve.NewMatchAllQuery(), excluded)); !reflect.DeepEqual(got, []string{"test-kept"}) {
+		t.Errorf("every scene without the excluded site was %v, expected test-kept", got)
+	}
+	if got := search(withoutSites(textQuery("beach", SearchModeQueryString), nil)); len(got) != 3 {
+		t.Errorf("beach matched %v with no excluded sites, expected all 3", got)
+	}
+}
+
+func TestIndexScenesByIDs(t *testing.T) {
+	idx := newTestIndex(t)
+
+	for _, scene := range []models.Scene{
+		{SceneID: "test-fixed", Title: "Beach Dya"},
+		{SceneID: "test-deleted", Title: "Forest Day"},
+		{SceneID: "test-untouched", Title: "Beach Night"},
+	} {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the db after fixing the title of test-fixed and deleting test-deleted
+	db := map[string]models.Scene{
+		"test-fixed":     {SceneID: "test-fixed", Title: "Beach Day", Cast: []models.Actor{{Name: "Riley Reid"}}},
+		"test-added":     {SceneID: "test-added", Title: "Lake Day"},
+		"test-untouched": {SceneID: "test-untouched", Title: "Beach Night Changed"},
+	}
+	var loaded []string
+	load := func(ids []string) ([]models.Scene, error) {
+		loaded = ids
+		var scenes []models.Scene
+		for _, id := range ids {
+			if scene, ok := db[id]; ok {
+				scenes = append(scenes, scene)
+			}
+		}
+		return scenes, nil
+	}
+
+	result, err := idx.indexScenesByIDs([]string{"test-fixed", "test-deleted", "test-missing", "test-added", "test-fixed"}, load, idx.BatchScene)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, []string{"test-fixed", "test-deleted", "test-missing", "test-added"}) {
+		t.Errorf("loaded %v, expected each id once", loaded)
+	}
+	if result.Indexed != 2 || !reflect.DeepEqual(result.Missing, []string{"test-deleted", "test-missing"}) || len(result.Failed) != 0 {
+		t.Errorf("result %+v, expected 2 indexed and test-deleted and test-missing missing", result)
+	}
+
+	if si, err := idx.storedScene("test-fixed"); err != nil || si.Title != "Beach Day" || len(si.CastExact) != 1 {
+		t.Errorf("test-fixed indexed as %+v (%v), expected the fixed title and cast", si, err)
+	}
+	if idx.Exist("test-deleted") {
+		t.Errorf("test-deleted is still indexed")
+	}
+	if !idx.Exist("test-added") {
+		t.Errorf("test-added was not indexed")
+	}
+	if si, _ := idx.storedScene("test-untouched"); si.Title != "Beach Night" {
+		t.Errorf("test-untouched was reindexed as %q, only the selected scenes should be", si.Title)
+	}
+
+	if result, err := idx.indexScenesByIDs(nil, load, idx.BatchScene); err != nil || result.Indexed != 0 || len(result.Failed) != 0 {
+		t.Errorf("no ids gave %+v (%v), expected nothing indexed", result, err)
+	}
+}
+
+func TestSearchSuggestions(t *testing.T) {
+	idx := newTestIndex(t)
+
+	for _, scene := range []models.Scene{
+		{SceneID: "test-riley", Title: "Beach Day", Cast: []models.Actor{{Name: "Riley Reid"}}},
+		{SceneID: "test-rylee", Title: "Forest Day", Cast: []models.Actor{{Name: "Rylee Rose"}}},
+	} {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	suggestions, err := idx.suggestions("rilye beach")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) == 0 || suggestions[0] != "riley beach" {
+		t.Errorf("suggestions %v, expected riley beach first", suggestions)
+	}
+	for _, s := range suggestions {
+		if s == "rilye beach" {
+			t.Errorf("suggestions %v include the original query", suggestions)
+		}
+	}
+
+	// nothing to correct when every word is a term, or too short to correct
+	for _, q := range []string{"riley beach", "xy", "cast:rilye"} {
+		suggestions, err := idx.suggestions(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if suggestions != nil {
+			t.Errorf("suggestions for %q %v, expected none", q, suggestions)
+		}
+	}
+}
+
+func TestIndexScenesRetry(t *testing.T) {
+	idx := newTestIndex(t)
+
+	scenes := []models.Scene{
+		{SceneID: "test-ok", Title: "Beach Day"},
+		{SceneID: "test-flaky", Title: "Forest Day"},
+		{SceneID: "test-broken", Title: "Lake Day"},
+	}
+	// test-flaky fails the first time its batch is written, test-broken every time. A batch does not list its ids,
+	// so it is written and the failing scenes are removed again
+	attempts := map[string]int{}
+	write := func(batch *bleve.Batch) error {
+		if err := idx.Batch(batch); err != nil {
+			return err
+		}
+		for _, id := range []string{"test-flaky", "test-broken"} {
+			d, err := idx.Bleve.Document(id)
+			if err != nil {
+				return err
+			}
+			if d == nil || attempts[id] == 2 {
+				continue
+			}
+			attempts[id]++
+			if id == "test-broken" || attempts[id] == 1 {
+				idx.Bleve.Delete(id)
+				return fmt.Errorf("cannot write %v", id)
+			}
+		}
+		return nil
+	}
+
+	indexed, failed := idx.indexScenes(scenes, 1, write)
+	if indexed != 2 {
+		t.Errorf("expected 2 indexed scenes, got %v", indexed)
+	}
+	if len(failed) != 1 || failed[0] != "test-broken" {
+		t.Errorf("expected test-broken to fail, got %v", failed)
+	}
+	if attempts["test-flaky"] != 2 || attempts["test-broken"] != 2 {
+		t.Errorf("expected the failed scenes to be retried once, got %v", attempts)
+	}
+	for id, want := range map[string]bool{"test-ok": true, "test-flaky": true, "test-broken": false} {
+		d, err := idx.Bleve.Document(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (d != nil) != want {
+			t.Errorf("%v indexed = %v, want %v", id, d != nil, want)
+		}
+	}
+}
+
+func TestParseSearchDate(t *testing.T) {
+	tests := []struct {
+		input   string
+		locale  string
+		want    string
+		wantErr bool
+	}{
+		{input: "2024-04-03", want: "2024-04-03"},
+		{input: " 2024-04-03 ", locale: "en-US", want: "2024-04-03"},
+		{input: "2024/4/3", locale: "en-GB", want: "2024-04-03"},
+		{input: "03/04/2024", locale: "en-GB", want: "2024-04-03"},
+		{input: "03.04.2024", locale: "de_DE", want: "2024-04-03"},
+		{input: "03/04/2024", locale: "en-US", want: "2024-03-04"},
+		{input: "2024.04.03", locale: "ja", want: "2024-04-03"},
+		{input: "3 Apr 2024", want: "2024-04-03"},
+		{input: "April 3, 2024", locale: "fr", want: "2024-04-03"},
+		// numeric dates without a locale could be read either way
+		{input: "03/04/2024", wantErr: true},
+		{input: "31/04/2024", locale: "en-GB", wantErr: true},
+		{input: "13/04/2024", locale: "en-US", wantErr: true},
+		{input: "03/04/24", locale: "en-GB", wantErr: true},
+		{input: "03/04-2024", locale: "en-GB", wantErr: true},
+		{input: "yesterday", locale: "en-GB", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSearchDate(tt.input, tt.locale)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseSearchDate(%q, %q) = %v, expected an error", tt.input, tt.locale, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSearchDate(%q, %q): %v", tt.input, tt.locale, err)
+			continue
+		}
+		if got.Location() != time.UTC || got.Format("2006-01-02 15:04") != tt.want+" 00:00" {
+			t.Errorf("parseSearchDate(%q, %q) = %v, expected %v", tt.input, tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearchDateRange(t *testing.T) {
+	saved := config.Config.Advanced.SearchDateLocale
+	t.Cleanup(func() { config.Config.Advanced.SearchDateLocale = saved })
+	config.Config.Advanced.SearchDateLocale = "en-GB"
+
+	r, err := ParseSearchDateRange("01/03/2024", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.After == nil || r.After.Format("2006-01-02") != "2024-03-01" || r.Before != nil || !r.AfterInclusive {
+		t.Errorf("unexpected range %+v", r)
+	}
+	if _, err := ParseSearchDateRange("2024-03-01", "31/02/2024"); err == nil {
+		t.Error("expected an error for 31 February")
+	}
+	if _, err := ParseSearchDateRange("2024-03-01", "2024-02-01"); err == nil {
+		t.Error("expected an error for a range ending before it starts")
+	}
+}
+
+func TestExactSceneID(t *testing.T) {
+	idx := newTestIndex(t)
+
+	for _, scene := range []models.Scene{
+		{SceneID: "czechvr-123", Title: "Beach Day", Site: "Czech VR", Tags: []models.Tag{{Name: "pov"}}, Favourite: true},
+		{SceneID: "czechvr-1234", Title: "Beach Day 123"},
+		{SceneID: "czechvr-12", Title: "Czechvr 123"},
+	} {
+		if err := idx.PutScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for q, want := range map[string]string{
+		"czechvr-123":   "czechvr-123",
+		" CzechVR-123 ": "czechvr-123",
+		"czechvr-999":   "",
+		"czechvr 123":   "",
+		"beach-day":     "",
+		"czechvr":       "",
+	} {
+		si, ok := idx.exactScene(q)
+		if si.IdExact != want || ok != (want != "") {
+			t.Errorf("exactScene(%q) = %q, %v, expected %q", q, si.IdExact, ok, want)
+		}
+	}
+
+	saved := config.Config.Web.SearchExcludeSites
+	t.Cleanup(func() { config.Config.Web.SearchExcludeSites = saved })
+	config.Config.Web.SearchExcludeSites = nil
+
+	si, _ := idx.exactScene("czechvr-123")
+	for name, tt := range map[string]struct {
+		opts    SceneSearchOptions
+		exclude []string
+		want    bool
+	}{
+		"no options":          {want: true},
+		"favourites":          {opts: SceneSearchOptions{FavouriteOnly: true}, want: true},
+		"wishlist":            {opts: SceneSearchOptions{WishlistOnly: true}, want: false},
+		"excluded site":       {exclude: []string{"Czech VR"}, want: false},
+		"excluded site shown": {opts: SceneSearchOptions{IncludeExcludedSites: true}, exclude: []string{"Czech VR"}, want: true},
+		"allowed tag":         {opts: SceneSearchOptions{ContentFilter: &SceneContentFilter{AllowedTags: []string{"pov"}}}, want: true},
+		"other allowed tag":   {opts: SceneSearchOptions{ContentFilter: &SceneContentFilter{AllowedTags: []string{"outdoor"}}}, want: false},
+		"blocked tag":         {opts: SceneSearchOptions{ContentFilter: &SceneContentFilter{BlockedTags: []string{"pov"}}}, want: false},
+		"allowed site":        {opts: SceneSearchOptions{ContentFilter: &SceneContentFilter{AllowedSites: []string{"Czech VR"}}}, want: true},
+		"blocked site":        {opts: SceneSearchOptions{ContentFilter: &SceneContentFilter{BlockedSites: []string{"Czech VR"}}}, want: false},
+		"blocked other site":  {opts: SceneSearchOptions{ContentFilter: &SceneContentFilter{BlockedSites: []string{"VR Bangers"}}}, want: true},
+	} {
+		config.Config.Web.SearchExcludeSites = tt.exclude
+		if got := exactSceneVisible(si, tt.opts); got != tt.want {
+			t.Errorf("%v: exactSceneVisible = %v, expected %v", name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryFailedIndexScenesKeepsFailures(t *testing.T) {
+	idx := newTestIndex(t)
+
+	if err := idx.PutScene(models.Scene{SceneID: "test-broken", Title: "Old Title"}); err != nil {
+		t.Fatal(err)
+	}
+
+	db := map[string]models.Scene{
+		"test-broken": {SceneID: "test-broken", Title: "New Title"},
+		"test-fixed":  {SceneID: "test-fixed", Title: "Beach Day"},
+	}
+	load := func(ids []string) ([]models.Scene, error) {
+		var scenes []models.Scene
+		for _, id := range ids {
+			if scene, ok := db[id]; ok {
+				scenes = append(scenes, scene)
+			}
+		}
+		return scenes, nil
+	}
+	put := func(batch *bleve.Batch, scene models.Scene) error {
+		if scene.SceneID == "test-broken" {
+			return fmt.Errorf("cannot index %v", scene.SceneID)
+		}
+		return idx.BatchScene(batch, scene)
+	}
+	reindex := func(ids []string) (SceneIndexResult, error) {
+		return idx.indexScenesByIDs(ids, load, put)
+	}
+
+	var saved []string
+	err := retryFailedIndexScenes([]string{"test-broken", "test-fixed", "test-deleted"}, reindex, func(ids []string) { saved = ids })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(saved, []string{"test-broken"}) {
+		t.Errorf("saved %v, expected only test-broken to be retried again", saved)
+	}
+	// the scene failing again keeps its old document rather than being deleted
+	if si, err := idx.storedScene("test-broken"); err != nil || si.Title != "Old Title" {
+		t.Errorf("test-broken indexed as %+v (%v), expected the old document", si, err)
+	}
+	if !idx.Exist("test-fixed") {
+		t.Error("test-fixed was not indexed")
+	}
+
+	// nothing is saved when the batch cannot be written, the list is kept for the next run
+	saved = nil
+	failing := func(ids []string) (SceneIndexResult, error) { return SceneIndexResult{}, fmt.Errorf("index closed") }
+	if err := retryFailedIndexScenes([]string{"test-broken"}, failing, func(ids []string) { saved = ids }); err == nil || saved != nil {
+		t.Errorf("expected the error and nothing saved, got %v and %v", err, saved)
+	}
+}
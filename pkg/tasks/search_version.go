@@ -0,0 +1,61 @@
+package tasks
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// sceneMappingVersion is increased whenever a field is added to SceneIndexed or its mapping changes,
+// an index built with an older version is rebuilt when it is opened instead of needing a migration
+//   - 1 the first recorded version
+//   - 2 id_exact
+//   - 3 has_cast and has_tags
+//   - 4 cast_count
+//   - 5 accents folded in the title, cast and searchable fields
+//   - 6 path
+//   - 7 cover_url
+//   - 8 has_script
+//   - 9 year
+//   - 10 updated_at
+//   - 11 rating
+//   - 12 image_count
+//   - 13 original_title
+//   - 14 file_size
+const sceneMappingVersion = 14
+
+type indexMeta struct {
+	MappingVersion int `json:"mapping_version"`
+}
+
+// indexMetaPath is next to the index rather than inside it, bleve owns the index directory
+func indexMetaPath(path string) string {
+	return path + ".meta.json"
+}
+
+// readMappingVersion returns the version the index at path was built with, 0 for an index built before
+// versions were recorded
+func readMappingVersion(path string) int {
+	data, err := os.ReadFile(indexMetaPath(path))
+	if err != nil {
+		return 0
+	}
+	var meta indexMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return 0
+	}
+	return meta.MappingVersion
+}
+
+func writeMappingVersion(path string) error {
+	data, err := json.Marshal(indexMeta{MappingVersion: sceneMappingVersion})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(indexMetaPath(path), data, 0644)
+}
+
+// MappingOutdated reports whether the index was built with an older mapping than the code, documents indexed
+// with it may be missing fields that searches and filters rely on
+func (i *Index) MappingOutdated() bool {
+	return i.mappingVersion < sceneMappingVersion
+}
@@ -33,7 +33,7 @@ func UpdateState() {
 func CalculateCacheSizes() {
 	config.State.CacheSize.Images, _ = common.DirSize(common.ImgDir)
 	config.State.CacheSize.Previews, _ = common.DirSize(common.VideoPreviewDir)
-	config.State.CacheSize.SearchIndex, _ = common.DirSize(common.IndexDirV2)
+	config.State.CacheSize.SearchIndex, _ = common.DirSize(IndexDir())
 
 	config.SaveState()
 }
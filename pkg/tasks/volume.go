@@ -117,7 +117,7 @@ func RescanVolumes(id int) {
 			if len(scenes) == 1 {
 				files[i].SceneID = scenes[0].ID
 				files[i].Save()
-				scenes[0].UpdateStatus()
+				RefreshSceneStatus(&scenes[0])
 			} else {
 				if config.Config.Storage.MatchOhash && config.Config.Advanced.StashApiKey != "" {
 					hash := files[i].OsHash
@@ -156,7 +156,7 @@ func RescanVolumes(id int) {
 								scene.Save()
 								models.AddAction(scene.SceneID, "match", "filenames_arr", scene.FilenamesArr)
 
-								scene.UpdateStatus()
+								RefreshSceneStatus(&scene)
 								log.Infof("File %s matched to Scene %s matched using stashdb hash %s", path.Base(files[i].Filename), scene.SceneID, hash)
 							}
 						}
@@ -397,7 +397,7 @@ func scanLocalVolume(vol models.Volume, db *gorm.DB, tlog *logrus.Entry) {
 				db.Delete(&allFiles[i])
 				if allFiles[i].SceneID != 0 {
 					scene.GetIfExistByPK(allFiles[i].SceneID)
-					scene.UpdateStatus()
+					RefreshSceneStatus(&scene)
 				}
 			}
 		}
@@ -456,7 +456,7 @@ func scanPutIO(vol models.Volume, db *gorm.DB, tlog *logrus.Entry) {
 			db.Delete(&allFiles[i])
 			if allFiles[i].SceneID != 0 {
 				scene.GetIfExistByPK(allFiles[i].SceneID)
-				scene.UpdateStatus()
+				RefreshSceneStatus(&scene)
 			}
 		}
 	}
@@ -478,7 +478,7 @@ func RefreshSceneStatuses() {
 	db.Model(&models.Scene{}).Find(&scenes)
 
 	for i := range scenes {
-		scenes[i].UpdateStatus()
+		RefreshSceneStatus(&scenes[i])
 		if (i % 70) == 0 {
 			tlog.Infof("Update status of Scenes (%v/%v)", i+1, len(scenes))
 		}
@@ -29,6 +29,7 @@ func main() {
 
 func onExit() {
 	systray.Quit()
+	server.Shutdown()
 	os.Exit(0)
 }
 
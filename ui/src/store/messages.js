@@ -4,6 +4,8 @@ const state = {
   lockRescan: false,
   lastRescanMessage: '',
   lastProgressMessage: '',
+  searchIndexProgress: null,
+  lastSearchIndexDone: null,
   runningScrapers: []
 }
 
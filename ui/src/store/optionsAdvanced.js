@@ -13,6 +13,11 @@ const state = {
     useAltSrcInFileMatching: true,
     useAltSrcInScriptFilters: true,
     ignoreReleasedBefore: null,
+    filenameStripWords: [],
+    filenameCodePatterns: [],
+    searchTitleAnalyzer: 'simple',
+    searchDescriptionAnalyzer: 'standard',
+    searchStemSearchable: false,
     collectorConfigs: null,
   }
 }
@@ -41,6 +46,11 @@ const actions = {
         state.advanced.useAltSrcInFileMatching = data.config.advanced.useAltSrcInFileMatching
         state.advanced.useAltSrcInScriptFilters = data.config.advanced.useAltSrcInScriptFilters
         state.advanced.ignoreReleasedBefore = data.config.advanced.ignoreReleasedBefore
+        state.advanced.filenameStripWords = data.config.advanced.filenameStripWords
+        state.advanced.filenameCodePatterns = data.config.advanced.filenameCodePatterns
+        state.advanced.searchTitleAnalyzer = data.config.advanced.searchTitleAnalyzer
+        state.advanced.searchDescriptionAnalyzer = data.config.advanced.searchDescriptionAnalyzer
+        state.advanced.searchStemSearchable = data.config.advanced.searchStemSearchable
         state.loading = false
       })
   },
@@ -60,6 +70,11 @@ const actions = {
         state.advanced.useAltSrcInFileMatching = data.useAltSrcInFileMatching
         state.advanced.useAltSrcInScriptFilters = data.useAltSrcInScriptFilters
         state.advanced.ignoreReleasedBefore = data.ignoreReleasedBefore
+        state.advanced.filenameStripWords = data.filenameStripWords
+        state.advanced.filenameCodePatterns = data.filenameCodePatterns
+        state.advanced.searchTitleAnalyzer = data.searchTitleAnalyzer
+        state.advanced.searchDescriptionAnalyzer = data.searchDescriptionAnalyzer
+        state.advanced.searchStemSearchable = data.searchStemSearchable
         state.loading = false
       })
   }
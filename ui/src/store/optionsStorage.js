@@ -7,6 +7,8 @@ const state = {
     forbidden_video_ext: [],
     video_ext: [],
     default_video_ext: [],
+    index_path: '',
+    default_index_path: '',
   },  
 }
 
@@ -22,10 +24,12 @@ const actions = {
       state.options.forbidden_video_ext = data.forbidden_video_ext
       state.options.video_ext = data.video_ext
       state.options.default_video_ext = data.default_video_ext
+      state.options.index_path = data.index_path
+      state.options.default_index_path = data.default_index_path
     })
   },
   async save ({ state }, enabled) { 
-    ky.put('/api/options/storage', { json: { ...state.options } })      
+    await ky.put('/api/options/storage', { json: { ...state.options } })      
   },  
 }
 
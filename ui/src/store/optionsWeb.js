@@ -24,6 +24,9 @@ const state = {
     sceneCardScaleToFit: true,
     actorCardAspectRatio: "1:1",
     actorCardScaleToFit: true,
+    searchPageSize: 25,
+    searchMatchAnyWord: false,
+    searchExcludeSites: [],
     updateCheck: true
   }
 }
@@ -57,6 +60,9 @@ const actions = {
         state.web.sceneCardScaleToFit = data.config.web.sceneCardScaleToFit
         state.web.actorCardAspectRatio = data.config.web.actorCardAspectRatio
         state.web.actorCardScaleToFit = data.config.web.actorCardScaleToFit
+        state.web.searchPageSize = data.config.web.searchPageSize
+        state.web.searchMatchAnyWord = data.config.web.searchMatchAnyWord
+        state.web.searchExcludeSites = data.config.web.searchExcludeSites || []
         state.loading = false
       })
   },
@@ -86,6 +92,9 @@ const actions = {
         state.web.sceneCardScaleToFit = data.sceneCardScaleToFit
         state.web.actorCardAspectRatio = data.actorCardAspectRatio
         state.web.actorCardScaleToFit = data.actorCardScaleToFit
+        state.web.searchPageSize = data.searchPageSize
+        state.web.searchMatchAnyWord = data.searchMatchAnyWord
+        state.web.searchExcludeSites = data.searchExcludeSites || []
         state.loading = false
       })
   }